@@ -3,10 +3,10 @@ package wordclouds
 import "fmt"
 
 type Box struct {
-	Top    float64
-	Left   float64
-	Right  float64
-	Bottom float64
+	Top    float64 `json:"top"`
+	Left   float64 `json:"left"`
+	Right  float64 `json:"right"`
+	Bottom float64 `json:"bottom"`
 }
 
 func (a *Box) x() float64 {
@@ -10,11 +10,12 @@ type point struct {
 	y float64
 }
 
-func newCircle(cx float64, cy float64, radius float64, maxSteps int) *circle {
+// newEllipse returns maxSteps points on an ellipse centered on cx, cy with radii rx and ry
+func newEllipse(cx float64, cy float64, rx float64, ry float64, maxSteps int) *circle {
 	pts := make([]point, maxSteps, maxSteps)
 	for i := 0; i < maxSteps; i++ {
-		pts[i].x = cx + radius*math.Cos(float64(i)*(2*math.Pi/float64(maxSteps)))
-		pts[i].y = cy + radius*math.Sin(float64(i)*(2*math.Pi/float64(maxSteps)))
+		pts[i].x = cx + rx*math.Cos(float64(i)*(2*math.Pi/float64(maxSteps)))
+		pts[i].y = cy + ry*math.Sin(float64(i)*(2*math.Pi/float64(maxSteps)))
 	}
 
 	return &circle{
@@ -25,3 +26,21 @@ func newCircle(cx float64, cy float64, radius float64, maxSteps int) *circle {
 func (c *circle) positions() []point {
 	return c.points
 }
+
+// aspect returns the horizontal and vertical scales of search shapes, so that they follow the canvas aspect ratio.
+// The shorter side is not scaled.
+func aspect(width int, height int) (sx float64, sy float64) {
+	return math.Max(float64(width)/float64(height), 1), math.Max(float64(height)/float64(width), 1)
+}
+
+// coverRadius returns the radius of the smallest shape centered on cx, cy and scaled by sx, sy that covers the
+// whole canvas
+func coverRadius(cx float64, cy float64, width int, height int, sx float64, sy float64) float64 {
+	r := 0.0
+	for _, x := range []float64{0, float64(width)} {
+		for _, y := range []float64{0, float64(height)} {
+			r = math.Max(r, math.Hypot((x-cx)/sx, (y-cy)/sy))
+		}
+	}
+	return r
+}
@@ -0,0 +1,131 @@
+package wordclouds
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"strconv"
+)
+
+// imageColors colors words with the average color of an image under them
+type imageColors struct {
+	img     image.Image
+	scale   float64
+	xoffset float64
+	yoffset float64
+}
+
+// newImageColors scales and centers img on a width x height canvas like MaskFromImage
+func newImageColors(img image.Image, width int, height int) *imageColors {
+	scale, xoffset, yoffset := fitImage(img.Bounds(), width, height)
+	return &imageColors{img: img, scale: scale, xoffset: xoffset, yoffset: yoffset}
+}
+
+// at returns the average color of the image pixels under boxes, weighted by their alpha. ok is false when the
+// boxes only cover transparent pixels or are outside of the image.
+func (ic *imageColors) at(boxes []*Box) (c color.Color, ok bool) {
+	bounds := ic.img.Bounds()
+	var r, g, b, a uint64
+	for _, box := range boxes {
+		rect := image.Rect(
+			int(math.Floor((box.Left-ic.xoffset)/ic.scale)),
+			int(math.Floor((box.Bottom-ic.yoffset)/ic.scale)),
+			int(math.Ceil((box.Right-ic.xoffset)/ic.scale)),
+			int(math.Ceil((box.Top-ic.yoffset)/ic.scale)),
+		).Add(bounds.Min).Intersect(bounds)
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			for y := rect.Min.Y; y < rect.Max.Y; y++ {
+				pr, pg, pb, pa := ic.img.At(x, y).RGBA()
+				r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+			}
+		}
+	}
+	if a == 0 {
+		return nil, false
+	}
+	// Components are premultiplied, dividing by the total alpha gives an opaque color
+	return color.NRGBA{
+		R: uint8(r * 0xff / a),
+		G: uint8(g * 0xff / a),
+		B: uint8(b * 0xff / a),
+		A: 0xff,
+	}, true
+}
+
+// color function returning the color of a word given its rank in the word list, its count relative to the
+// most frequent word, in ]0:1], and its spread from the least (0) to the most (1) frequent word.
+// Returning nil picks a random color from Options.Colors.
+// Random choices must be drawn from rng so that seeded layouts are reproducible.
+type colorFunction func(rng *rand.Rand, word string, rank int, weight float64, spread float64) color.Color
+
+// Colormap is a gradient through evenly spaced colors
+type Colormap []color.Color
+
+// Perceptually uniform colormaps from matplotlib
+var (
+	Viridis = hexColormap("440154", "482878", "3e4989", "31688e", "26828e", "1f9e89", "35b779", "6ece58", "b5de2b", "fde725")
+	Magma   = hexColormap("000004", "180f3d", "440f76", "721f81", "9e2f7f", "cd4071", "f1605d", "fd9668", "feca8d", "fcfdbf")
+	Inferno = hexColormap("000004", "160b39", "420a68", "6a176e", "932667", "bc3754", "dd513a", "f37819", "fca50a", "f6d746", "fcffa4")
+	Plasma  = hexColormap("0d0887", "41049d", "6a00a8", "8f0da4", "b12a90", "cc4778", "e16462", "f2844b", "fca636", "fcce25", "f0f921")
+)
+
+// At returns the color at t, between 0 and 1, interpolating between the two closest colors
+func (c Colormap) At(t float64) color.Color {
+	if len(c) == 0 {
+		return nil
+	}
+	t = math.Max(0, math.Min(1, t)) * float64(len(c)-1)
+	i := int(t)
+	if i >= len(c)-1 {
+		return c[len(c)-1]
+	}
+	a := color.NRGBAModel.Convert(c[i]).(color.NRGBA)
+	b := color.NRGBAModel.Convert(c[i+1]).(color.NRGBA)
+	f := t - float64(i)
+	mix := func(x uint8, y uint8) uint8 {
+		return uint8(math.Round(float64(x) + f*(float64(y)-float64(x))))
+	}
+	return color.NRGBA{R: mix(a.R, b.R), G: mix(a.G, b.G), B: mix(a.B, b.B), A: mix(a.A, b.A)}
+}
+
+func hexColormap(hex ...string) Colormap {
+	c := make(Colormap, 0, len(hex))
+	for _, h := range hex {
+		v, _ := strconv.ParseUint(h, 16, 32)
+		c = append(c, color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff})
+	}
+	return c
+}
+
+// colorBySpread picks the color of the word count in a colormap, from the least to the most frequent word
+func colorBySpread(c Colormap) colorFunction {
+	return func(_ *rand.Rand, _ string, _ int, _ float64, spread float64) color.Color {
+		return c.At(spread)
+	}
+}
+
+// colorByRank gives the same color to each bucket of size words, the last color is used for the remaining words
+func colorByRank(size int, colors []color.Color) colorFunction {
+	return func(_ *rand.Rand, _ string, rank int, _ float64, _ float64) color.Color {
+		return colors[min(rank/size, len(colors)-1)]
+	}
+}
+
+// colorByWord looks the word up in a map
+func colorByWord(colors map[string]color.Color) colorFunction {
+	return func(_ *rand.Rand, word string, _ int, _ float64, _ float64) color.Color {
+		return colors[word]
+	}
+}
+
+// colorByCategory looks the category of the word up in a palette
+func colorByCategory(categories map[string]string, palette map[string]color.Color) colorFunction {
+	return func(_ *rand.Rand, word string, _ int, _ float64, _ float64) color.Color {
+		category, ok := categories[word]
+		if !ok {
+			return nil
+		}
+		return palette[category]
+	}
+}
@@ -0,0 +1,60 @@
+package wordclouds
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoWords is returned when a wordcloud is created from an empty word list.
+var ErrNoWords = errors.New("wordclouds: empty word list")
+
+// OptionError reports an invalid option value.
+type OptionError struct {
+	Option string
+	Reason string
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("wordclouds: invalid option %s: %s", e.Option, e.Reason)
+}
+
+// WordError reports an invalid entry of a weighted word list.
+type WordError struct {
+	Word   string
+	Reason string
+}
+
+func (e *WordError) Error() string {
+	return fmt.Sprintf("wordclouds: invalid word %q: %s", e.Word, e.Reason)
+}
+
+// FontError reports a font that could not be loaded. Path describes the FontSource for fonts that are not files.
+type FontError struct {
+	Path string
+	Err  error
+}
+
+func (e *FontError) Error() string {
+	return fmt.Sprintf("wordclouds: can not load font %q: %v", e.Path, e.Err)
+}
+
+func (e *FontError) Unwrap() error {
+	return e.Err
+}
+
+// MaskError reports a mask that could not be built.
+type MaskError struct {
+	Path string
+	Err  error
+}
+
+func (e *MaskError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("wordclouds: invalid mask: %v", e.Err)
+	}
+	return fmt.Sprintf("wordclouds: invalid mask %q: %v", e.Path, e.Err)
+}
+
+func (e *MaskError) Unwrap() error {
+	return e.Err
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"image"
 	"image/color"
 	"image/png"
 	"log"
@@ -10,13 +11,17 @@ import (
 	"os"
 	"path/filepath"
 	"runtime/pprof"
+	"strings"
 	"time"
 
 	"github.com/psykhi/wordclouds"
+	"github.com/psykhi/wordclouds/tokenizer"
 	"gopkg.in/yaml.v2"
 )
 
 var path = flag.String("input", "input.yaml", "path to flat YAML like {\"word\":42,...}")
+var text = flag.String("text", "", "path to a raw text file. Words are counted from it instead of using input")
+var languages = flag.String("languages", "en", "comma separated stopword languages used with -text")
 var config = flag.String("config", "config.yaml", "path to config file")
 var output = flag.String("output", "output.png", "path to output image")
 var cpuprofile = flag.String("cpuprofile", "profile", "write cpu profile to file")
@@ -30,22 +35,92 @@ var DefaultColors = []color.RGBA{
 }
 
 type Conf struct {
-	FontMaxSize     int    `yaml:"font_max_size"`
-	FontMinSize     int    `yaml:"font_min_size"`
-	RandomPlacement bool   `yaml:"random_placement"`
-	FontFile        string `yaml:"font_file"`
+	FontMaxSize     int      `yaml:"font_max_size"`
+	FontMinSize     int      `yaml:"font_min_size"`
+	RandomPlacement bool     `yaml:"random_placement"`
+	Placement       string   `yaml:"placement"`
+	Origin          *[2]int  `yaml:"origin"`
+	ShrinkToFit     bool     `yaml:"shrink_to_fit"`
+	AutoFit         float64  `yaml:"auto_fit"`
+	FontFile        string   `yaml:"font_file"`
+	FallbackFonts   []string `yaml:"fallback_fonts"`
 	Colors          []color.RGBA
 	BackgroundColor color.RGBA `yaml:"background_color"`
 	Width           int
 	Height          int
 	Mask            MaskConf
-	SizeFunction    *string `yaml:"size_function"`
+	SizeFunction    *string          `yaml:"size_function"`
+	SizeExponent    float64          `yaml:"size_exponent"`
+	SizeByRank      bool             `yaml:"size_by_rank"`
+	ColorScheme     *ColorSchemeConf `yaml:"color_scheme"`
 	Debug           bool
 }
 
 type MaskConf struct {
-	File  string
-	Color color.RGBA
+	File      string
+	Color     color.RGBA
+	Tolerance float64
+	Invert    bool
+	// One of circle, ellipse, heart, star, used instead of File
+	Shape string
+	// Color the words with the mask image
+	Colors bool
+}
+
+// ColorSchemeConf colors the words instead of picking random colors
+type ColorSchemeConf struct {
+	// One of colormap, rank, words, categories
+	Type string
+	// One of viridis, magma, inferno, plasma, for the colormap type
+	Colormap string
+	// Number of words per color for the rank type, which uses colors in order
+	Bucket int
+	// Word colors for the words type
+	Words map[string]color.RGBA
+	// Word categories and category colors for the categories type
+	Categories map[string]string
+	Palette    map[string]color.RGBA
+}
+
+var colormaps = map[string]wordclouds.Colormap{
+	"viridis": wordclouds.Viridis,
+	"magma":   wordclouds.Magma,
+	"inferno": wordclouds.Inferno,
+	"plasma":  wordclouds.Plasma,
+}
+
+// option returns the option setting the color scheme
+func (c *ColorSchemeConf) option(colors []color.Color) (wordclouds.Option, error) {
+	switch c.Type {
+	case "colormap":
+		cmap, ok := colormaps[c.Colormap]
+		if !ok {
+			return nil, fmt.Errorf("unknown colormap %q", c.Colormap)
+		}
+		return wordclouds.ColorsByCount(cmap), nil
+	case "rank":
+		return wordclouds.RankBuckets(c.Bucket, colors), nil
+	case "words":
+		return wordclouds.WordColors(toColors(c.Words)), nil
+	case "categories":
+		return wordclouds.CategoryColors(c.Categories, toColors(c.Palette)), nil
+	}
+	return nil, fmt.Errorf("unknown color scheme %q", c.Type)
+}
+
+func toColors(m map[string]color.RGBA) map[string]color.Color {
+	res := make(map[string]color.Color, len(m))
+	for k, c := range m {
+		res[k] = c
+	}
+	return res
+}
+
+var shapes = map[string]func() (wordclouds.Shape, error){
+	"circle":  func() (wordclouds.Shape, error) { return wordclouds.CircleShape(), nil },
+	"ellipse": func() (wordclouds.Shape, error) { return wordclouds.EllipseShape(), nil },
+	"heart":   func() (wordclouds.Shape, error) { return wordclouds.HeartShape(), nil },
+	"star":    func() (wordclouds.Shape, error) { return wordclouds.StarShape(5, 0.45) },
 }
 
 var DefaultConf = Conf{
@@ -57,7 +132,7 @@ var DefaultConf = Conf{
 	BackgroundColor: color.RGBA{255, 255, 255, 255},
 	Width:           4096,
 	Height:          4096,
-	Mask: MaskConf{"", color.RGBA{
+	Mask: MaskConf{File: "", Color: color.RGBA{
 		R: 0,
 		G: 0,
 		B: 0,
@@ -79,19 +154,32 @@ func main() {
 	}
 
 	// Load words
-	content, err := os.ReadFile(*path)
-	if err != nil {
-		panic(err)
-	}
-	inputWords := make(map[string]int, 0)
-	err = yaml.Unmarshal(content, &inputWords)
-	if err != nil {
-		panic(err)
+	var inputWords map[string]int
+	if *text != "" {
+		f, err := os.Open(*text)
+		if err != nil {
+			panic(err)
+		}
+		inputWords, err = tokenizer.Count(f, tokenizer.Languages(strings.Split(*languages, ",")...))
+		f.Close()
+		if err != nil {
+			panic(err)
+		}
+	} else {
+		content, err := os.ReadFile(*path)
+		if err != nil {
+			panic(err)
+		}
+		inputWords = make(map[string]int, 0)
+		err = yaml.Unmarshal(content, &inputWords)
+		if err != nil {
+			panic(err)
+		}
 	}
 
 	// Load config
 	conf := DefaultConf
-	content, err = os.ReadFile(*config)
+	content, err := os.ReadFile(*config)
 	if err == nil {
 		err = yaml.Unmarshal(content, &conf)
 		if err != nil {
@@ -108,12 +196,41 @@ func main() {
 	}
 
 	var boxes []*wordclouds.Box
-	if conf.Mask.File != "" {
-		boxes = wordclouds.Mask(
+	if conf.Mask.Shape != "" {
+		newShape, ok := shapes[conf.Mask.Shape]
+		if !ok {
+			log.Fatalf("unknown mask shape %q", conf.Mask.Shape)
+		}
+		shape, err := newShape()
+		if err != nil {
+			log.Fatal(err)
+		}
+		boxes, err = wordclouds.ShapeMask(shape, conf.Width, conf.Height)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if conf.Mask.File != "" && conf.Mask.Tolerance == 0 && !conf.Mask.Invert {
+		boxes, err = wordclouds.LoadMask(
 			conf.Mask.File,
 			conf.Width,
 			conf.Height,
 			conf.Mask.Color)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if conf.Mask.File != "" {
+		rule := wordclouds.ExcludeColor(conf.Mask.Color, conf.Mask.Tolerance)
+		if conf.Mask.Invert {
+			rule = rule.Invert()
+		}
+		boxes, err = wordclouds.LoadMaskFunc(
+			conf.Mask.File,
+			conf.Width,
+			conf.Height,
+			rule)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 
 	colors := make([]color.Color, 0)
@@ -122,7 +239,7 @@ func main() {
 	}
 
 	start := time.Now()
-	oarr := []wordclouds.Option{wordclouds.FontFile(conf.FontFile),
+	oarr := []wordclouds.Option{wordclouds.FontFiles(append([]string{conf.FontFile}, conf.FallbackFonts...)...),
 		wordclouds.FontMaxSize(conf.FontMaxSize),
 		wordclouds.FontMinSize(conf.FontMinSize),
 		wordclouds.Colors(colors),
@@ -131,15 +248,61 @@ func main() {
 		wordclouds.Width(conf.Width),
 		wordclouds.RandomPlacement(conf.RandomPlacement),
 		wordclouds.BackgroundColor(conf.BackgroundColor)}
+	switch conf.Placement {
+	case "", "circle":
+	case "archimedean":
+		oarr = append(oarr, wordclouds.Placement(&wordclouds.ArchimedeanPlacer{}))
+	case "rectangular":
+		oarr = append(oarr, wordclouds.Placement(&wordclouds.RectangularPlacer{}))
+	default:
+		log.Fatalf("unknown placement %q", conf.Placement)
+	}
+	if conf.Origin != nil {
+		oarr = append(oarr, wordclouds.Origin(conf.Origin[0], conf.Origin[1]))
+	}
+	if conf.Mask.Colors && conf.Mask.File != "" {
+		f, err := os.Open(conf.Mask.File)
+		if err != nil {
+			log.Fatal(err)
+		}
+		img, _, err := image.Decode(f)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		oarr = append(oarr, wordclouds.ColorsFromImage(img))
+	}
+	if conf.ShrinkToFit {
+		oarr = append(oarr, wordclouds.ShrinkToFit())
+	}
+	if conf.AutoFit > 0 {
+		oarr = append(oarr, wordclouds.AutoFit(conf.AutoFit))
+	}
+	if conf.ColorScheme != nil {
+		opt, err := conf.ColorScheme.option(colors)
+		if err != nil {
+			log.Fatal(err)
+		}
+		oarr = append(oarr, opt)
+	}
 	if conf.SizeFunction != nil {
 		oarr = append(oarr, wordclouds.WordSizeFunction(*conf.SizeFunction))
 	}
+	if conf.SizeExponent != 0 {
+		oarr = append(oarr, wordclouds.WordSizePower(conf.SizeExponent))
+	}
+	if conf.SizeByRank {
+		oarr = append(oarr, wordclouds.SizeByRank())
+	}
 	if conf.Debug {
 		oarr = append(oarr, wordclouds.Debug())
 	}
-	w := wordclouds.NewWordcloud(inputWords,
+	w, err := wordclouds.New(inputWords,
 		oarr...,
 	)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	img := w.Draw()
 	outputFile, err := os.Create(*output)
@@ -153,5 +316,9 @@ func main() {
 
 	// Don't forget to close files
 	outputFile.Close()
+	if conf.ShrinkToFit || conf.AutoFit > 0 {
+		l := w.Layout()
+		fmt.Printf("Layout passes: %d, scale: %.2f, fill: %.2f\n", l.Passes, l.Scale, l.Fill)
+	}
 	fmt.Printf("Done in %v\n", time.Since(start))
 }
@@ -0,0 +1,372 @@
+package wordclouds
+
+import (
+	"fmt"
+	"image"
+	"io/fs"
+	"math/rand"
+	"os"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// FontSource is a font to load: a file, a file in an fs.FS, raw bytes or an already parsed font
+type FontSource struct {
+	path string
+	fsys fs.FS
+	data []byte
+	ttf  *truetype.Font
+	otf  *opentype.Font
+}
+
+// FontPath loads a TTF or OTF file from disk
+func FontPath(path string) FontSource {
+	return FontSource{path: path}
+}
+
+// FontFS loads a TTF or OTF file from fsys, such as an embed.FS
+func FontFS(fsys fs.FS, path string) FontSource {
+	return FontSource{path: path, fsys: fsys}
+}
+
+// FontBytes parses the content of a TTF or OTF file
+func FontBytes(data []byte) FontSource {
+	return FontSource{data: data}
+}
+
+// TrueTypeFont uses a font parsed with github.com/golang/freetype/truetype
+func TrueTypeFont(f *truetype.Font) FontSource {
+	return FontSource{ttf: f}
+}
+
+// OpenTypeFont uses a font parsed with golang.org/x/image/font/opentype
+func OpenTypeFont(f *opentype.Font) FontSource {
+	return FontSource{otf: f}
+}
+
+// DefaultFont is the font used when no font is set: Go Regular, embedded in the package
+var DefaultFont = FontBytes(goregular.TTF)
+
+// String describes the source for error messages
+func (src FontSource) String() string {
+	switch {
+	case src.fsys != nil:
+		return "fs:" + src.path
+	case src.path != "":
+		return src.path
+	case src.data != nil:
+		return fmt.Sprintf("<%d bytes>", len(src.data))
+	default:
+		return "<parsed font>"
+	}
+}
+
+// load parses the font. The returned error is a *FontError.
+func (src FontSource) load() (typeface, error) {
+	switch {
+	case src.ttf != nil:
+		return &trueTypeface{src.ttf}, nil
+	case src.otf != nil:
+		return &openTypeface{f: src.otf}, nil
+	}
+
+	data := src.data
+	if data == nil {
+		var err error
+		if src.fsys != nil {
+			data, err = fs.ReadFile(src.fsys, src.path)
+		} else {
+			data, err = os.ReadFile(src.path)
+		}
+		if err != nil {
+			return nil, &FontError{Path: src.String(), Err: err}
+		}
+	}
+
+	// Prefer the TrueType rasterizer, OpenType fonts with CFF outlines are only supported by sfnt
+	if f, err := truetype.Parse(data); err == nil {
+		return &trueTypeface{f}, nil
+	}
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, &FontError{Path: src.String(), Err: err}
+	}
+	return &openTypeface{f: f}, nil
+}
+
+// typeface is a parsed font that can create faces of any size
+type typeface interface {
+	hasGlyph(r rune) bool
+	face(size float64) font.Face
+	family() string
+}
+
+type trueTypeface struct {
+	f *truetype.Font
+}
+
+func (t *trueTypeface) hasGlyph(r rune) bool {
+	return t.f.Index(r) != 0
+}
+
+func (t *trueTypeface) face(size float64) font.Face {
+	return truetype.NewFace(t.f, &truetype.Options{Size: size})
+}
+
+func (t *trueTypeface) family() string {
+	return t.f.Name(truetype.NameIDFontFamily)
+}
+
+type openTypeface struct {
+	f   *opentype.Font
+	buf sfnt.Buffer
+}
+
+func (t *openTypeface) hasGlyph(r rune) bool {
+	idx, err := t.f.GlyphIndex(&t.buf, r)
+	return err == nil && idx != 0
+}
+
+func (t *openTypeface) face(size float64) font.Face {
+	// NewFace does not fail with explicit options
+	f, _ := opentype.NewFace(t.f, &opentype.FaceOptions{Size: size, DPI: 72})
+	return f
+}
+
+func (t *openTypeface) family() string {
+	name, err := t.f.Name(&t.buf, sfnt.NameIDFamily)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// font function returning the index of the font of a word in Options.WordFonts given its rank in the word list.
+// Out of range indices select the default font.
+type fontFunction func(rng *rand.Rand, word string, rank int) int
+
+// pickRandomFont picks one of n fonts at random for each word
+func pickRandomFont(n int) fontFunction {
+	return func(rng *rand.Rand, _ string, _ int) int {
+		return rng.Intn(n)
+	}
+}
+
+type faceKey struct {
+	font int
+	size float64
+}
+
+// fontSet holds the parsed fonts of a wordcloud and caches their faces.
+// The first font is the default font, followed by the fallback fonts.
+type fontSet struct {
+	fonts     []typeface
+	fallbacks []int
+	words     []int
+	faces     map[faceKey]font.Face
+}
+
+// loadFonts parses FontFile, Fonts and WordFonts. Files on disk are parsed once even if they appear several times.
+func loadFonts(opts Options) (*fontSet, error) {
+	s := &fontSet{
+		faces: make(map[faceKey]font.Face),
+	}
+	indices := make(map[string]int)
+	load := func(src FontSource) (int, error) {
+		// Only files on disk can be deduplicated, the same path in two fs.FS may be two fonts
+		key := ""
+		if src.fsys == nil && src.data == nil && src.ttf == nil && src.otf == nil {
+			key = src.path
+			if idx, ok := indices[key]; ok {
+				return idx, nil
+			}
+		}
+		f, err := src.load()
+		if err != nil {
+			return 0, err
+		}
+		s.fonts = append(s.fonts, f)
+		if key != "" {
+			indices[key] = len(s.fonts) - 1
+		}
+		return len(s.fonts) - 1, nil
+	}
+
+	chain := opts.Fonts
+	if opts.FontFile != "" {
+		chain = append([]FontSource{FontPath(opts.FontFile)}, chain...)
+	}
+	if len(chain) == 0 {
+		chain = []FontSource{DefaultFont}
+	}
+	for i, src := range chain {
+		idx, err := load(src)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 && idx != 0 {
+			s.fallbacks = append(s.fallbacks, idx)
+		}
+	}
+	for _, src := range opts.WordFonts {
+		idx, err := load(src)
+		if err != nil {
+			return nil, err
+		}
+		s.words = append(s.words, idx)
+	}
+	return s, nil
+}
+
+// chain returns the fonts to try in order for a word. wordFont is an index in Options.WordFonts.
+func (s *fontSet) chain(wordFont int) []int {
+	res := make([]int, 0, len(s.fallbacks)+2)
+	if wordFont >= 0 && wordFont < len(s.words) {
+		res = append(res, s.words[wordFont])
+	}
+	for _, idx := range append([]int{0}, s.fallbacks...) {
+		if !containsInt(res, idx) {
+			res = append(res, idx)
+		}
+	}
+	return res
+}
+
+// face returns a face drawing each rune of word with the first font of the chain that has a glyph for it
+func (s *fontSet) face(chain []int, word string, size float64) font.Face {
+	used := make([]int, 0, 1)
+	for _, r := range word {
+		idx := chain[0]
+		for _, c := range chain {
+			if s.fonts[c].hasGlyph(r) {
+				idx = c
+				break
+			}
+		}
+		if !containsInt(used, idx) {
+			used = append(used, idx)
+		}
+	}
+	if len(used) == 0 {
+		return s.sizedFace(chain[0], size)
+	}
+	if len(used) == 1 {
+		return s.sizedFace(used[0], size)
+	}
+
+	// Keep the order of the chain so that runes are looked up in the same order
+	ff := &fallbackFace{}
+	for _, c := range chain {
+		if containsInt(used, c) {
+			ff.fonts = append(ff.fonts, s.fonts[c])
+			ff.faces = append(ff.faces, s.sizedFace(c, size))
+		}
+	}
+	return ff
+}
+
+// Max number of cached faces. Each face holds a glyph cache, and font sizes are rarely reused once words are
+// sorted by size, so the cache is emptied when it is full.
+const maxFaces = 8
+
+func (s *fontSet) sizedFace(idx int, size float64) font.Face {
+	key := faceKey{idx, size}
+	f, ok := s.faces[key]
+	if !ok {
+		if len(s.faces) >= maxFaces {
+			s.clearFaces()
+		}
+		f = s.fonts[idx].face(size)
+		s.faces[key] = f
+	}
+	return f
+}
+
+// clearFaces empties the face cache, for instance when a layout pass starts over with other sizes
+func (s *fontSet) clearFaces() {
+	s.faces = make(map[faceKey]font.Face)
+}
+
+// family returns a CSS font-family list for a chain of fonts
+func (s *fontSet) family(chain []int) string {
+	res := ""
+	for _, idx := range chain {
+		name := s.fonts[idx].family()
+		if name != "" {
+			res += "'" + name + "', "
+		}
+	}
+	return res + "sans-serif"
+}
+
+func containsInt(s []int, v int) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// fallbackFace is a font.Face delegating each rune to the first face whose font has a glyph for it.
+// Its metrics cover all the faces.
+type fallbackFace struct {
+	fonts []typeface
+	faces []font.Face
+}
+
+func (f *fallbackFace) pick(r rune) font.Face {
+	for i, ft := range f.fonts {
+		if ft.hasGlyph(r) {
+			return f.faces[i]
+		}
+	}
+	return f.faces[0]
+}
+
+func (f *fallbackFace) Close() error {
+	return nil
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (
+	dr image.Rectangle, mask image.Image, maskp image.Point, advance fixed.Int26_6, ok bool) {
+	return f.pick(r).Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (bounds fixed.Rectangle26_6, advance fixed.Int26_6, ok bool) {
+	return f.pick(r).GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (advance fixed.Int26_6, ok bool) {
+	return f.pick(r).GlyphAdvance(r)
+}
+
+func (f *fallbackFace) Kern(r0 rune, r1 rune) fixed.Int26_6 {
+	face := f.pick(r0)
+	if face != f.pick(r1) {
+		return 0
+	}
+	return face.Kern(r0, r1)
+}
+
+func (f *fallbackFace) Metrics() font.Metrics {
+	m := f.faces[0].Metrics()
+	for _, face := range f.faces[1:] {
+		fm := face.Metrics()
+		if fm.Height > m.Height {
+			m.Height = fm.Height
+		}
+		if fm.Ascent > m.Ascent {
+			m.Ascent = fm.Ascent
+		}
+		if fm.Descent > m.Descent {
+			m.Descent = fm.Descent
+		}
+	}
+	return m
+}
@@ -0,0 +1,80 @@
+package wordclouds
+
+import "math"
+
+// Max number of slices used to approximate a rotated rectangle
+const maxCoverSlices = 16
+
+// cover approximates the area covered by a word with boxes relative to the word anchor
+type cover []Box
+
+// newCover covers the rectangle [left:right]x[bottom:top] around the anchor, rotated by angle degrees clockwise.
+// Rectangles that are not axis aligned are cut in slices along their longest side so that the bounding box of each
+// slice stays close to the rotated glyphs.
+func newCover(top float64, left float64, right float64, bottom float64, angle float64) cover {
+	rad := angle * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+	w, h := right-left, top-bottom
+
+	slices := 1
+	if math.Mod(angle, 90) != 0 {
+		slices = int(math.Ceil(math.Max(w, h) / math.Min(w, h)))
+		if slices > maxCoverSlices {
+			slices = maxCoverSlices
+		}
+	}
+
+	c := make(cover, 0, slices)
+	for i := 0; i < slices; i++ {
+		t, l, r, b := top, left, right, bottom
+		if w >= h {
+			l = left + w*float64(i)/float64(slices)
+			r = left + w*float64(i+1)/float64(slices)
+		} else {
+			b = bottom + h*float64(i)/float64(slices)
+			t = bottom + h*float64(i+1)/float64(slices)
+		}
+		c = append(c, rotatedBounds(t, l, r, b, sin, cos))
+	}
+	return c
+}
+
+// rotatedBounds returns the bounding box of a rectangle rotated around the origin
+func rotatedBounds(top float64, left float64, right float64, bottom float64, sin float64, cos float64) Box {
+	res := Box{
+		Top:    math.Inf(-1),
+		Left:   math.Inf(1),
+		Right:  math.Inf(-1),
+		Bottom: math.Inf(1),
+	}
+	for _, c := range [4]point{{left, bottom}, {right, bottom}, {right, top}, {left, top}} {
+		x := c.x*cos - c.y*sin
+		y := c.x*sin + c.y*cos
+		res.Left = math.Min(res.Left, x)
+		res.Right = math.Max(res.Right, x)
+		res.Bottom = math.Min(res.Bottom, y)
+		res.Top = math.Max(res.Top, y)
+	}
+	return res
+}
+
+// at returns the cover boxes moved to the anchor x, y
+func (c cover) at(x float64, y float64) []*Box {
+	res := make([]*Box, 0, len(c))
+	for _, b := range c {
+		res = append(res, &Box{b.Top + y, b.Left + x, b.Right + x, b.Bottom + y})
+	}
+	return res
+}
+
+// bounds returns the bounding box of all the boxes
+func bounds(boxes []*Box) Box {
+	res := *boxes[0]
+	for _, b := range boxes[1:] {
+		res.Top = math.Max(res.Top, b.Top)
+		res.Left = math.Min(res.Left, b.Left)
+		res.Right = math.Max(res.Right, b.Right)
+		res.Bottom = math.Min(res.Bottom, b.Bottom)
+	}
+	return res
+}
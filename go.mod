@@ -4,14 +4,14 @@ go 1.18
 
 require (
 	github.com/fogleman/gg v1.3.0
-	github.com/google/uuid v1.3.1
+	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	github.com/stretchr/testify v1.4.0
 	golang.org/x/image v0.5.0
+	golang.org/x/text v0.7.0
 	gopkg.in/yaml.v2 v2.2.8
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.0 // indirect
-	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 )
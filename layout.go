@@ -0,0 +1,99 @@
+package wordclouds
+
+import (
+	"context"
+	"fmt"
+	"image/color"
+)
+
+// Layout is the computed placement of a wordcloud. It can be serialized to JSON and used for hit-testing,
+// tooltips or animations on the client side.
+type Layout struct {
+	Width    int          `json:"width"`
+	Height   int          `json:"height"`
+	Words    []PlacedWord `json:"words"`
+	Unplaced []string     `json:"unplaced"`
+	// Number of layout passes, more than 1 when ShrinkToFit had to restart with smaller fonts or with AutoFit
+	Passes int `json:"passes"`
+	// Scale applied to the font sizes in the last pass
+	Scale float64 `json:"scale"`
+	// Ratio of the canvas outside of the mask covered by the text boxes of the words
+	Fill float64 `json:"fill"`
+}
+
+// PlacedWord is a word drawn on the canvas.
+// X and Y are the anchor point of the word, at the center of its text box. Baseline is the y coordinate of the
+// text baseline. Width and Height are the size of the text box before rotation, which happens around the anchor.
+type PlacedWord struct {
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+	// Weight given to NewWeighted, or the count
+	Weight   float64 `json:"weight"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Baseline float64 `json:"baseline"`
+	Width    float64 `json:"width"`
+	Height   float64 `json:"height"`
+	FontSize float64 `json:"font_size"`
+	// CSS font-family list, in fallback order
+	FontFamily string `json:"font_family"`
+	// Color in CSS hex notation
+	Color string `json:"color"`
+	// Rotation in degrees, clockwise
+	Rotation float64 `json:"rotation"`
+	// Boxes used for collision detection
+	Boxes []*Box `json:"boxes"`
+	// URL and Meta of the Word given to NewWeighted
+	URL  string                 `json:"url,omitempty"`
+	Meta map[string]interface{} `json:"meta,omitempty"`
+}
+
+// Layout places the words like Draw and returns every placed word along with the words that did not fit.
+func (w *Wordcloud) Layout() Layout {
+	_ = w.layout(context.Background())
+
+	l := Layout{
+		Width:    w.opts.Width,
+		Height:   w.opts.Height,
+		Words:    make([]PlacedWord, 0, len(w.placements)),
+		Unplaced: make([]string, 0, len(w.unplaced)),
+		Passes:   w.passes,
+		Scale:    w.scale,
+		Fill:     w.fill(),
+	}
+	for _, p := range w.placements {
+		boxes := make([]*Box, 0, len(p.boxes))
+		for _, b := range p.boxes {
+			cp := *b
+			boxes = append(boxes, &cp)
+		}
+		l.Words = append(l.Words, PlacedWord{
+			Word:       p.word,
+			Count:      p.count,
+			Weight:     p.weight,
+			X:          p.x,
+			Y:          p.y,
+			Baseline:   p.baseline,
+			Width:      p.width,
+			Height:     p.height,
+			FontSize:   p.size,
+			FontFamily: p.family,
+			Color:      hexColor(p.color),
+			Rotation:   p.rotation,
+			Boxes:      boxes,
+			URL:        p.url,
+			Meta:       p.meta,
+		})
+	}
+	l.Unplaced = append(l.Unplaced, w.unplaced...)
+	return l
+}
+
+// hexColor formats c as #rrggbb, or #rrggbbaa when it is not opaque
+func hexColor(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	if n.A == 0xff {
+		return fmt.Sprintf("#%02x%02x%02x", n.R, n.G, n.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", n.R, n.G, n.B, n.A)
+}
@@ -1,33 +1,90 @@
 package wordclouds
 
 import (
+	"errors"
+	"fmt"
+	"image"
 	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
 	"math"
+	"os"
 
-	"github.com/fogleman/gg"
+	_ "golang.org/x/image/webp"
 )
 
 // Mask creates a slice of box structs from a given mask image to be passed to wordclouds.MaskBoxes.
+// Mask panics if the image can not be loaded. Use LoadMask to get an error instead.
 func Mask(path string, width int, height int, exclude color.RGBA) []*Box {
-	res := make([]*Box, 0)
-
-	img, err := gg.LoadPNG(path)
+	res, err := LoadMask(path, width, height, exclude)
 	if err != nil {
 		panic(err)
 	}
+	return res
+}
+
+// LoadMask creates a slice of box structs from the image at path. The returned error is a *MaskError.
+// The image is split in cells of 3x3 pixels, a cell is masked when its top left pixel is of the exclude color.
+func LoadMask(path string, width int, height int, exclude color.RGBA) ([]*Box, error) {
+	return loadMask(path, width, height, excludeExactly(exclude), sampled)
+}
+
+// LoadMaskFunc creates a slice of box structs from the image at path, masking the pixels matched by rule as
+// MaskFromImageFunc does. PNG, JPEG, GIF and WebP images are supported, as well as any format registered with
+// image.RegisterFormat. The returned error is a *MaskError.
+func LoadMaskFunc(path string, width int, height int, rule MaskRule) ([]*Box, error) {
+	return loadMask(path, width, height, rule, masked)
+}
+
+func loadMask(path string, width int, height int, rule MaskRule, sample cellSampler) ([]*Box, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, &MaskError{Path: path, Err: err}
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, &MaskError{Path: path, Err: err}
+	}
+	res, err := maskFromImage(img, width, height, rule, sample)
+	if err != nil {
+		return nil, &MaskError{Path: path, Err: errors.Unwrap(err)}
+	}
+	return res, nil
+}
+
+// MaskFromImage creates a slice of box structs from img, scaled and centered on a width x height canvas.
+// The image is split in cells of 3x3 pixels, a cell is masked when its top left pixel is of the exclude color.
+// The returned error is a *MaskError.
+func MaskFromImage(img image.Image, width int, height int, exclude color.RGBA) ([]*Box, error) {
+	return maskFromImage(img, width, height, excludeExactly(exclude), sampled)
+}
+
+// MaskFromImageFunc creates a slice of box structs from img, scaled and centered on a width x height canvas.
+// The image is split in cells of 3x3 pixels, a cell is masked when most of its pixels are matched by rule, so that
+// isolated pixels such as JPEG noise do not change the mask. Unlike MaskFromImage, strokes thinner than 2 pixels
+// are not masked. The canvas around the image is always masked. The returned error is a *MaskError.
+func MaskFromImageFunc(img image.Image, width int, height int, rule MaskRule) ([]*Box, error) {
+	return maskFromImage(img, width, height, rule, masked)
+}
+
+func maskFromImage(img image.Image, width int, height int, rule MaskRule, sample cellSampler) ([]*Box, error) {
+	if width <= 0 || height <= 0 {
+		return nil, &MaskError{Err: fmt.Errorf("canvas size must be positive, got %dx%d", width, height)}
+	}
+	if img == nil || img.Bounds().Empty() {
+		return nil, &MaskError{Err: errors.New("empty image")}
+	}
+	if rule == nil {
+		return nil, &MaskError{Err: errors.New("nil mask rule")}
+	}
+	res := make([]*Box, 0)
 
-	// scale
 	imgw := img.Bounds().Dx()
 	imgh := img.Bounds().Dy()
-
-	wr := float64(width) / float64(imgw)
-	wh := float64(height) / float64(imgh)
-	scalingRatio := math.Min(wr, wh)
-	// center
-	xoffset := 0.0
-	yoffset := 0.0
-	if scalingRatio*float64(imgw) < float64(width) {
-		xoffset = (float64(width) - scalingRatio*float64(imgw)) / 2
+	scalingRatio, xoffset, yoffset := fitImage(img.Bounds(), width, height)
+	if xoffset > 0 {
 		res = append(res, &Box{
 			float64(height),
 			0.0,
@@ -42,8 +99,7 @@ func Mask(path string, width int, height int, exclude color.RGBA) []*Box {
 		})
 	}
 
-	if scalingRatio*float64(imgh) < float64(height) {
-		yoffset = (float64(height) - scalingRatio*float64(imgh)) / 2
+	if yoffset > 0 {
 		res = append(res, &Box{
 			yoffset,
 			0.0,
@@ -59,22 +115,156 @@ func Mask(path string, width int, height int, exclude color.RGBA) []*Box {
 	}
 	step := 3
 	bounds := img.Bounds()
-	for i := bounds.Min.X; i < bounds.Max.X; i = i + step {
-		for j := bounds.Min.Y; j < bounds.Max.Y; j = j + step {
-			r, g, b, a := img.At(i, j).RGBA()
-			er, eg, eb, ea := exclude.RGBA()
-
-			if r == er && g == eg && b == eb && a == ea {
-				b := &Box{
-					math.Min(float64(j+step)*scalingRatio+yoffset, float64(height)),
-					float64(i)*scalingRatio + xoffset,
-					math.Min(float64(i+step)*scalingRatio+xoffset, float64(width)),
-					float64(j)*scalingRatio + yoffset,
-				}
-				res = append(res, b)
+	cols, rows := (imgw+step-1)/step, (imgh+step-1)/step
+	cells := make([]bool, cols*rows)
+	for i := 0; i < cols; i++ {
+		for j := 0; j < rows; j++ {
+			cell := image.Rect(i*step, j*step, (i+1)*step, (j+1)*step).Add(bounds.Min).Intersect(bounds)
+			cells[j*cols+i] = sample(img, cell, rule)
+		}
+	}
+	// Adjacent cells are merged so that large masked areas only take a few boxes
+	for _, r := range mergeCells(cells, cols, rows) {
+		res = append(res, &Box{
+			math.Min(float64(r.Max.Y*step)*scalingRatio+yoffset, float64(height)),
+			float64(r.Min.X*step)*scalingRatio + xoffset,
+			math.Min(float64(r.Max.X*step)*scalingRatio+xoffset, float64(width)),
+			float64(r.Min.Y*step)*scalingRatio + yoffset,
+		})
+	}
+
+	return res, nil
+}
+
+// fitImage returns the ratio scaling an image with bounds b to fit a width x height canvas, and the offsets
+// centering it
+func fitImage(b image.Rectangle, width int, height int) (scale float64, xoffset float64, yoffset float64) {
+	scale = math.Min(float64(width)/float64(b.Dx()), float64(height)/float64(b.Dy()))
+	xoffset = math.Max((float64(width)-scale*float64(b.Dx()))/2, 0)
+	yoffset = math.Max((float64(height)-scale*float64(b.Dy()))/2, 0)
+	return
+}
+
+// cellSampler reports whether a cell of a mask image is masked
+type cellSampler func(img image.Image, cell image.Rectangle, rule MaskRule) bool
+
+// sampled reports whether the top left pixel of a cell is matched by rule
+func sampled(img image.Image, cell image.Rectangle, rule MaskRule) bool {
+	return rule(img.At(cell.Min.X, cell.Min.Y))
+}
+
+// masked reports whether most pixels of a cell are matched by rule, so that isolated pixels such as JPEG noise
+// do not change the mask
+func masked(img image.Image, cell image.Rectangle, rule MaskRule) bool {
+	count := 0
+	for x := cell.Min.X; x < cell.Max.X; x++ {
+		for y := cell.Min.Y; y < cell.Max.Y; y++ {
+			if rule(img.At(x, y)) {
+				count++
 			}
 		}
 	}
+	return 2*count > cell.Dx()*cell.Dy()
+}
 
+// mergeCells covers the set cells of a cols x rows grid with rectangles: runs of cells in a row are extended down
+// as long as the rows below have the same run
+func mergeCells(cells []bool, cols int, rows int) []image.Rectangle {
+	used := make([]bool, len(cells))
+	free := func(x int, y int) bool {
+		return cells[y*cols+x] && !used[y*cols+x]
+	}
+	res := make([]image.Rectangle, 0)
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			if !free(x, y) {
+				continue
+			}
+			x1 := x + 1
+			for x1 < cols && free(x1, y) {
+				x1++
+			}
+			y1 := y + 1
+			for ; y1 < rows; y1++ {
+				run := true
+				for i := x; i < x1 && run; i++ {
+					run = free(i, y1)
+				}
+				if !run {
+					break
+				}
+			}
+			for j := y; j < y1; j++ {
+				for i := x; i < x1; i++ {
+					used[j*cols+i] = true
+				}
+			}
+			res = append(res, image.Rect(x, y, x1, y1))
+			x = x1 - 1
+		}
+	}
 	return res
 }
+
+// MaskRule reports whether a pixel of a mask image is masked, in which case no word can be drawn over it
+type MaskRule func(c color.Color) bool
+
+// ExcludeColor masks the pixels whose distance to c is at most tolerance. The distance is the euclidean distance
+// between the alpha-premultiplied 8 bit RGBA components, from 0 to 510, so all fully transparent pixels are equal.
+// A tolerance of 0 only masks c.
+func ExcludeColor(c color.Color, tolerance float64) MaskRule {
+	rr, rg, rb, ra := c.RGBA()
+	return func(c color.Color) bool {
+		r, g, b, a := c.RGBA()
+		dr := float64(r>>8) - float64(rr>>8)
+		dg := float64(g>>8) - float64(rg>>8)
+		db := float64(b>>8) - float64(rb>>8)
+		da := float64(a>>8) - float64(ra>>8)
+		return math.Sqrt(dr*dr+dg*dg+db*db+da*da) <= tolerance
+	}
+}
+
+// excludeExactly masks the pixels of the exclude color, comparing the 16 bit components
+func excludeExactly(exclude color.RGBA) MaskRule {
+	er, eg, eb, ea := exclude.RGBA()
+	return func(c color.Color) bool {
+		r, g, b, a := c.RGBA()
+		return r == er && g == eg && b == eb && a == ea
+	}
+}
+
+// ExcludeAlphaBelow masks the pixels with an alpha lower than threshold, such as the transparent background of
+// a PNG shape
+func ExcludeAlphaBelow(threshold uint8) MaskRule {
+	return func(c color.Color) bool {
+		return color.NRGBAModel.Convert(c).(color.NRGBA).A < threshold
+	}
+}
+
+// ExcludeLight masks the pixels with a luminance of at least threshold, between 0 and 1, such as the white
+// background of a scanned shape. Alpha is ignored.
+func ExcludeLight(threshold float64) MaskRule {
+	return func(c color.Color) bool {
+		return luminance(c) >= threshold
+	}
+}
+
+// ExcludeDark masks the pixels with a luminance lower than threshold, between 0 and 1. Alpha is ignored.
+func ExcludeDark(threshold float64) MaskRule {
+	return func(c color.Color) bool {
+		return luminance(c) < threshold
+	}
+}
+
+// Invert masks the pixels that r does not mask, so that words are placed outside of the shape instead of inside
+func (r MaskRule) Invert() MaskRule {
+	return func(c color.Color) bool {
+		return !r(c)
+	}
+}
+
+// luminance returns the relative luminance of c, between 0 and 1
+func luminance(c color.Color) float64 {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return (0.2126*float64(n.R) + 0.7152*float64(n.G) + 0.0722*float64(n.B)) / 255
+}
@@ -0,0 +1,194 @@
+package wordclouds
+
+import (
+	"image"
+	"math"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+)
+
+// occupancy is a packed bitmap of the canvas with one bit per pixel, set where a word or the mask covers it
+type occupancy struct {
+	width  int
+	height int
+	stride int
+	bits   []uint64
+}
+
+func newOccupancy(width int, height int) *occupancy {
+	stride := (width + 63) / 64
+	return &occupancy{
+		width:  width,
+		height: height,
+		stride: stride,
+		bits:   make([]uint64, stride*height),
+	}
+}
+
+// fillBox marks the pixels covered by a box
+func (o *occupancy) fillBox(b *Box) {
+	x0, x1 := clampInt(int(math.Floor(b.Left)), 0, o.width), clampInt(int(math.Ceil(b.Right)), 0, o.width)
+	y0, y1 := clampInt(int(math.Floor(b.Bottom)), 0, o.height), clampInt(int(math.Ceil(b.Top)), 0, o.height)
+	for y := y0; y < y1; y++ {
+		row := o.bits[y*o.stride:]
+		for x := x0; x < x1; x++ {
+			row[x/64] |= 1 << uint(x%64)
+		}
+	}
+}
+
+// fits reports whether a sprite anchored at x, y is inside the canvas and does not overlap any set pixel
+func (o *occupancy) fits(s *sprite, x int, y int) bool {
+	left, top := x-s.ax, y-s.ay
+	if left < 0 || top < 0 || left+s.width > o.width || top+s.height > o.height {
+		return false
+	}
+	return !o.apply(s, left, top, false)
+}
+
+// add marks the pixels of a sprite anchored at x, y
+func (o *occupancy) add(s *sprite, x int, y int) {
+	o.apply(s, x-s.ax, y-s.ay, true)
+}
+
+// apply tests the sprite rows against the canvas rows, shifting them by the horizontal offset.
+// With set, the sprite is also merged into the canvas. Otherwise it returns as soon as a pixel overlaps.
+func (o *occupancy) apply(s *sprite, left int, top int, set bool) bool {
+	base, shift := left/64, uint(left%64)
+	for r := 0; r < s.height; r++ {
+		row := o.bits[(top+r)*o.stride : (top+r+1)*o.stride]
+		for k, sw := range s.bits[r*s.stride : (r+1)*s.stride] {
+			if sw == 0 {
+				continue
+			}
+			lo := sw << shift
+			var hi uint64
+			if shift > 0 {
+				hi = sw >> (64 - shift)
+			}
+			if set {
+				row[base+k] |= lo
+				if hi != 0 {
+					row[base+k+1] |= hi
+				}
+				continue
+			}
+			if row[base+k]&lo != 0 || (hi != 0 && row[base+k+1]&hi != 0) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sprite is the packed alpha mask of a word, dilated by the collision margin
+type sprite struct {
+	width  int
+	height int
+	stride int
+	bits   []uint64
+	// anchor of the word in the sprite
+	ax int
+	ay int
+}
+
+// newSprite renders a word rotated by angle degrees around its anchor and keeps the pixels with ink.
+// b is the box covered by the word relative to its anchor, it only needs to be roughly right.
+func newSprite(face font.Face, word string, angle float64, b Box, margin int) *sprite {
+	pad := int(math.Ceil(math.Max(b.w(), b.h())/4)) + margin
+	ax, ay := int(math.Ceil(-b.Left))+pad, int(math.Ceil(-b.Bottom))+pad
+	w, h := ax+int(math.Ceil(b.Right))+pad, ay+int(math.Ceil(b.Top))+pad
+
+	dc := gg.NewContext(w, h)
+	dc.SetFontFace(face)
+	dc.SetRGB(0, 0, 0)
+	dc.RotateAbout(gg.Radians(angle), float64(ax), float64(ay))
+	dc.DrawStringAnchored(word, float64(ax), float64(ay), 0.5, 0.5)
+	img := dc.Image().(*image.RGBA)
+
+	// Dilate the ink by the margin, then crop to the inked area
+	ink := make([]bool, w*h)
+	inked := image.Rectangle{}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if img.Pix[y*img.Stride+x*4+3] == 0 {
+				continue
+			}
+			ink[y*w+x] = true
+			inked = inked.Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+	if inked.Empty() {
+		return &sprite{ax: 0, ay: 0}
+	}
+	ink = dilate(ink, w, h, margin)
+	inked = image.Rect(inked.Min.X-margin, inked.Min.Y-margin, inked.Max.X+margin, inked.Max.Y+margin).
+		Intersect(image.Rect(0, 0, w, h))
+
+	s := &sprite{
+		width:  inked.Dx(),
+		height: inked.Dy(),
+		stride: (inked.Dx() + 63) / 64,
+		ax:     ax - inked.Min.X,
+		ay:     ay - inked.Min.Y,
+	}
+	s.bits = make([]uint64, s.stride*s.height)
+	for y := 0; y < s.height; y++ {
+		for x := 0; x < s.width; x++ {
+			if ink[(y+inked.Min.Y)*w+x+inked.Min.X] {
+				s.bits[y*s.stride+x/64] |= 1 << uint(x%64)
+			}
+		}
+	}
+	return s
+}
+
+// dilate grows the set pixels by margin pixels in every direction
+func dilate(pix []bool, w int, h int, margin int) []bool {
+	if margin <= 0 {
+		return pix
+	}
+	// Horizontal then vertical pass, counting the set pixels in a sliding window
+	tmp := make([]bool, len(pix))
+	for y := 0; y < h; y++ {
+		count := 0
+		for x := -margin; x < w; x++ {
+			if x+margin < w && pix[y*w+x+margin] {
+				count++
+			}
+			if x-margin-1 >= 0 && pix[y*w+x-margin-1] {
+				count--
+			}
+			if x >= 0 {
+				tmp[y*w+x] = count > 0
+			}
+		}
+	}
+	res := make([]bool, len(pix))
+	for x := 0; x < w; x++ {
+		count := 0
+		for y := -margin; y < h; y++ {
+			if y+margin < h && tmp[(y+margin)*w+x] {
+				count++
+			}
+			if y-margin-1 >= 0 && tmp[(y-margin-1)*w+x] {
+				count--
+			}
+			if y >= 0 {
+				res[y*w+x] = count > 0
+			}
+		}
+	}
+	return res
+}
+
+func clampInt(v int, lo int, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
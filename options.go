@@ -1,21 +1,43 @@
 package wordclouds
 
 import (
+	"fmt"
+	"image"
 	"image/color"
+	"math"
+	"math/rand"
 )
 
 type Options struct {
-	FontMaxSize     int
-	FontMinSize     int
-	RandomPlacement bool
-	FontFile        string
-	Colors          []color.Color
-	BackgroundColor color.Color
-	Width           int
-	Height          int
-	Mask            []*Box
-	SizeFunction    sizeFunction
-	Debug           bool
+	FontMaxSize      int
+	FontMinSize      int
+	RandomPlacement  bool
+	Placer           Placer
+	Origin           *image.Point
+	FontFile         string
+	Fonts            []FontSource
+	WordFonts        []FontSource
+	WordFontFunction fontFunction
+	Colors           []color.Color
+	ColorImage       image.Image
+	ColorFunction    colorFunction
+	BackgroundColor  color.Color
+	Width            int
+	Height           int
+	Mask             []*Box
+	PixelCollision   bool
+	CollisionMargin  int
+	SizeFunction     SizeFunc
+	SizeByRank       bool
+	Rotation         rotationFunction
+	Seed             *int64
+	Progress         func(pass int, placed int, total int, fontSize float64)
+	ShrinkToFit      bool
+	FillTarget       float64
+	Debug            bool
+
+	// err records an invalid option value, reported by New
+	err error
 }
 
 var defaultOptions = Options{
@@ -23,7 +45,8 @@ var defaultOptions = Options{
 	FontMinSize:     10,
 	RandomPlacement: false,
 	FontFile:        "",
-	Colors:          []color.Color{color.RGBA{}},
+	Fonts:           nil,
+	Colors:          []color.Color{color.RGBA{A: 0xff}},
 	BackgroundColor: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
 	Width:           2048,
 	Height:          2048,
@@ -34,20 +57,75 @@ var defaultOptions = Options{
 
 type Option func(*Options)
 
-// Path to font file
+// Path to font file. It always comes first: fonts set with Fonts or FontFiles are used as fallbacks, whatever the
+// order of the options.
 func FontFile(path string) Option {
 	return func(options *Options) {
 		options.FontFile = path
 	}
 }
 
-// Output file background color
+// Ordered list of font files. Each character is drawn with the first font that has a glyph for it,
+// so that words mixing scripts or emoji do not render as boxes.
+func FontFiles(paths ...string) Option {
+	srcs := make([]FontSource, 0, len(paths))
+	for _, path := range paths {
+		srcs = append(srcs, FontPath(path))
+	}
+	return Fonts(srcs...)
+}
+
+// Ordered list of fonts, loaded from files, bytes, an fs.FS or already parsed. See FontFiles.
+// When FontFile is also set, these fonts are its fallbacks. Without any font, DefaultFont is used.
+func Fonts(srcs ...FontSource) Option {
+	return func(options *Options) {
+		if len(srcs) == 0 {
+			options.err = &OptionError{Option: "Fonts", Reason: "at least one font is required"}
+			return
+		}
+		options.Fonts = srcs
+	}
+}
+
+// Pick the font of each word among fonts with a callback receiving the word and its rank, for instance to draw
+// the top words in bold. The callback returns an index in fonts, any other value selects the default font.
+// Characters missing from the picked font fall back to the fonts set with Fonts or FontFiles.
+func WordFontFunction(fonts []FontSource, f func(word string, rank int) int) Option {
+	return func(options *Options) {
+		options.WordFonts = fonts
+		options.WordFontFunction = func(_ *rand.Rand, word string, rank int) int {
+			return f(word, rank)
+		}
+	}
+}
+
+// Pick the font of each word at random among fonts
+func RandomFonts(fonts ...FontSource) Option {
+	return func(options *Options) {
+		if len(fonts) == 0 {
+			options.err = &OptionError{Option: "WordFonts", Reason: "at least one font is required"}
+			return
+		}
+		options.WordFonts = fonts
+		options.WordFontFunction = pickRandomFont(len(fonts))
+	}
+}
+
+// Output file background color. It may be translucent.
 func BackgroundColor(color color.Color) Option {
 	return func(options *Options) {
 		options.BackgroundColor = color
 	}
 }
 
+// Leave the background transparent, so that the image can be laid over other content. Save it in a format with
+// an alpha channel, such as PNG.
+func TransparentBackground() Option {
+	return func(options *Options) {
+		options.BackgroundColor = color.Transparent
+	}
+}
+
 // Colors to use for the words
 func Colors(colors []color.Color) Option {
 	return func(options *Options) {
@@ -55,6 +133,68 @@ func Colors(colors []color.Color) Option {
 	}
 }
 
+// Color words by count along a colormap, such as Viridis: the least frequent words get the first color and the
+// most frequent word the last one
+func ColorsByCount(c Colormap) Option {
+	return func(options *Options) {
+		if len(c) == 0 {
+			options.err = &OptionError{Option: "ColorFunction", Reason: "empty colormap"}
+			return
+		}
+		options.ColorFunction = colorBySpread(c)
+	}
+}
+
+// Color words by rank: the first size words get the first color, the next size words the second color, and so on.
+// The last color is used for the remaining words.
+func RankBuckets(size int, colors []color.Color) Option {
+	return func(options *Options) {
+		if size <= 0 || len(colors) == 0 {
+			options.err = &OptionError{Option: "ColorFunction", Reason: "rank buckets need a positive size and colors"}
+			return
+		}
+		options.ColorFunction = colorByRank(size, colors)
+	}
+}
+
+// Set the color of words explicitly. Other words get a random color from Colors.
+func WordColors(colors map[string]color.Color) Option {
+	return func(options *Options) {
+		options.ColorFunction = colorByWord(colors)
+	}
+}
+
+// Color words by category, for instance by sentiment: categories maps words to a category and palette maps
+// categories to a color. Other words get a random color from Colors.
+func CategoryColors(categories map[string]string, palette map[string]color.Color) Option {
+	return func(options *Options) {
+		options.ColorFunction = colorByCategory(categories, palette)
+	}
+}
+
+// Set the color of each word with a callback receiving the word, its rank and its count relative to the most
+// frequent word, in ]0:1]. Returning nil picks a random color from Colors.
+func ColorFunction(f func(word string, rank int, weight float64) color.Color) Option {
+	return func(options *Options) {
+		options.ColorFunction = func(_ *rand.Rand, word string, rank int, weight float64, _ float64) color.Color {
+			return f(word, rank, weight)
+		}
+	}
+}
+
+// Color each word with the average color of img under it, for instance the image the mask was made from.
+// The image is scaled and centered on the canvas like MaskFromImage. Words over transparent areas or outside of
+// the image get a random color from Colors.
+func ColorsFromImage(img image.Image) Option {
+	return func(options *Options) {
+		if img == nil || img.Bounds().Empty() {
+			options.err = &OptionError{Option: "ColorImage", Reason: "empty image"}
+			return
+		}
+		options.ColorImage = img
+	}
+}
+
 // Max font size
 func FontMaxSize(max int) Option {
 	return func(options *Options) {
@@ -96,6 +236,22 @@ func RandomPlacement(do bool) Option {
 	}
 }
 
+// Search word positions with a custom placement strategy. Takes precedence over RandomPlacement.
+func Placement(p Placer) Option {
+	return func(options *Options) {
+		options.Placer = p
+	}
+}
+
+// Start the search for word positions at x, y instead of the center of the image, for instance to grow the cloud
+// next to a logo. Words are placed as close to the origin as possible.
+func Origin(x int, y int) Option {
+	return func(options *Options) {
+		origin := image.Pt(x, y)
+		options.Origin = &origin
+	}
+}
+
 // Set word font sizing function
 func WordSizeFunction(f string) Option {
 	return func(options *Options) {
@@ -106,15 +262,171 @@ func WordSizeFunction(f string) Option {
 			options.SizeFunction = sizeSqrt
 		case SizeFunctionSqrtInverse:
 			options.SizeFunction = sizeSqrtInverse
+		case SizeFunctionLog:
+			options.SizeFunction = sizeLog
 		default:
-			panic("No such size function " + f)
+			options.err = &OptionError{Option: "SizeFunction", Reason: "no such size function " + f}
 		}
 	}
 }
 
+// Set word font sizing function with a callback. Results are clamped to [0:1].
+func SizeFunction(f func(x float64) float64) Option {
+	return func(options *Options) {
+		options.SizeFunction = f
+	}
+}
+
+// Scale font sizes based on x^exponent. Exponents below 1 give larger fonts earlier, above 1 later.
+func WordSizePower(exponent float64) Option {
+	return func(options *Options) {
+		if exponent <= 0 || math.IsInf(exponent, 0) || math.IsNaN(exponent) {
+			options.err = &OptionError{
+				Option: "SizeFunction",
+				Reason: fmt.Sprintf("exponent must be positive, got %v", exponent),
+			}
+			return
+		}
+		options.SizeFunction = sizePower(exponent)
+	}
+}
+
+// Size words by their rank instead of their count: the size function gets 1 for the first word, 0 for the last one
+// and evenly spaced values in between. Words with the same count get the same size. This keeps long-tail word lists
+// readable when the top word is far more frequent than the others.
+func SizeByRank() Option {
+	return func(options *Options) {
+		options.SizeByRank = true
+	}
+}
+
+// Rotate each word by one of the given angles, in degrees clockwise, picked at random
+func Rotations(angles ...float64) Option {
+	return func(options *Options) {
+		if len(angles) == 0 {
+			options.err = &OptionError{Option: "Rotation", Reason: "at least one angle is required"}
+			return
+		}
+		options.Rotation = rotateAmong(angles)
+	}
+}
+
+// Turn words vertical with probability p. Vertical words read bottom to top.
+func VerticalProbability(p float64) Option {
+	return func(options *Options) {
+		if p < 0 || p > 1 {
+			options.err = &OptionError{Option: "Rotation", Reason: fmt.Sprintf("probability must be in [0:1], got %v", p)}
+			return
+		}
+		options.Rotation = rotateVertical(p)
+	}
+}
+
+// Set the rotation of each word, in degrees clockwise, with a callback receiving the word and its rank
+func RotationFunction(f func(word string, rank int) float64) Option {
+	return func(options *Options) {
+		options.Rotation = func(_ *rand.Rand, word string, rank int) float64 {
+			return f(word, rank)
+		}
+	}
+}
+
+// Seed the random number generator used for colors, rotations and random placement.
+// The same words and options then always produce the same image and layout.
+func Seed(seed int64) Option {
+	return func(options *Options) {
+		options.Seed = &seed
+	}
+}
+
+// Report progress after each word: the layout pass, starting at 1, the number of words placed so far in this pass,
+// the total number of words and the font size of the word that was just processed. ShrinkToFit and AutoFit may lay
+// the words out several times, the number of placed words starts over at 0 with each pass.
+func Progress(f func(pass int, placed int, total int, fontSize float64)) Option {
+	return func(options *Options) {
+		options.Progress = f
+	}
+}
+
+// Make sure every word is placed: words that do not fit are retried at smaller font sizes, down to FontMinSize.
+// If some words still do not fit, the layout restarts with all font sizes scaled down, until every word fits or all
+// of them are at FontMinSize. Layout reports the number of passes and the final scale.
+func ShrinkToFit() Option {
+	return func(options *Options) {
+		options.ShrinkToFit = true
+	}
+}
+
+// Scale all font sizes automatically so that every word is placed and the words cover the given ratio of the canvas
+// outside of the mask, between 0 and 1. Sizes start from FontMinSize and FontMaxSize: they shrink when words do not
+// fit, and grow above FontMaxSize when the words leave too much empty space. Each step of the search is a complete
+// layout, so it is several times slower than a single layout.
+func AutoFit(fill float64) Option {
+	return func(options *Options) {
+		if fill <= 0 || fill > 1 {
+			options.err = &OptionError{Option: "FillTarget", Reason: fmt.Sprintf("must be in ]0:1], got %v", fill)}
+			return
+		}
+		options.FillTarget = fill
+	}
+}
+
+// Detect collisions on the actual glyph pixels instead of bounding boxes, keeping margin pixels between words.
+// Words can then nest inside the counters of large letters.
+func PixelCollision(margin int) Option {
+	return func(options *Options) {
+		if margin < 0 {
+			options.err = &OptionError{Option: "CollisionMargin", Reason: fmt.Sprintf("must not be negative, got %d", margin)}
+			return
+		}
+		options.PixelCollision = true
+		options.CollisionMargin = margin
+	}
+}
+
 // Draw bounding boxes around words
 func Debug() Option {
 	return func(options *Options) {
 		options.Debug = true
 	}
 }
+
+// validate reports the first invalid option
+func (o *Options) validate() error {
+	if o.err != nil {
+		return o.err
+	}
+	if o.Width <= 0 {
+		return &OptionError{Option: "Width", Reason: fmt.Sprintf("must be positive, got %d", o.Width)}
+	}
+	if o.Height <= 0 {
+		return &OptionError{Option: "Height", Reason: fmt.Sprintf("must be positive, got %d", o.Height)}
+	}
+	if o.Origin != nil && !o.Origin.In(image.Rect(0, 0, o.Width, o.Height)) {
+		return &OptionError{Option: "Origin", Reason: fmt.Sprintf("must be inside the image, got %v", *o.Origin)}
+	}
+	if o.FontMinSize <= 0 {
+		return &OptionError{Option: "FontMinSize", Reason: fmt.Sprintf("must be positive, got %d", o.FontMinSize)}
+	}
+	if o.FontMinSize > o.FontMaxSize {
+		return &OptionError{
+			Option: "FontMaxSize",
+			Reason: fmt.Sprintf("must be at least FontMinSize (%d), got %d", o.FontMinSize, o.FontMaxSize),
+		}
+	}
+	if len(o.Colors) == 0 {
+		return &OptionError{Option: "Colors", Reason: "at least one color is required"}
+	}
+	for _, c := range o.Colors {
+		if c == nil {
+			return &OptionError{Option: "Colors", Reason: "nil color"}
+		}
+	}
+	if o.BackgroundColor == nil {
+		return &OptionError{Option: "BackgroundColor", Reason: "nil color"}
+	}
+	if o.SizeFunction == nil {
+		return &OptionError{Option: "SizeFunction", Reason: "nil size function"}
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package wordclouds
+
+import (
+	"context"
+	"image"
+	"math/rand"
+	"runtime"
+	"sync"
+)
+
+// Footprint describes a word to place
+type Footprint struct {
+	Word     string
+	Rank     int
+	FontSize float64
+	// Rotation in degrees, clockwise
+	Rotation float64
+	// Size of the box covering the word, rotation included, centered on the word anchor
+	Width  float64
+	Height float64
+}
+
+// Canvas is the drawing area, given to placers before the first word is placed.
+// Placers must draw their random numbers from Rand so that seeded layouts are reproducible.
+type Canvas struct {
+	Width  int
+	Height int
+	// Where the search starts: the center of the canvas unless set with the Origin option
+	Origin image.Point
+	Rand   *rand.Rand
+}
+
+// FitFunc reports whether a word fits with its anchor at x, y: inside the canvas, without overlapping the mask
+// or the words already placed. It is safe for concurrent use.
+type FitFunc func(x float64, y float64) bool
+
+// Placer searches a position for each word. Placers keep state about the canvas and can only be used by one
+// wordcloud at a time.
+type Placer interface {
+	// Init is called once before the first word is placed
+	Init(c Canvas)
+	// Place returns the position of the word anchor. ok is false when there is no space left for the word or
+	// ctx is done.
+	Place(ctx context.Context, fp Footprint, fits FitFunc) (x float64, y float64, ok bool)
+}
+
+// CirclePlacer tries positions on concentric circles starting at the canvas origin, closest first.
+// On canvases that are not square, circles are stretched into ellipses with the aspect ratio of the canvas.
+// Circles are tested in parallel. It is the default placer.
+type CirclePlacer struct {
+	rings [][]point
+}
+
+func (p *CirclePlacer) Init(c Canvas) {
+	p.rings = p.rings[:0]
+	cx, cy := float64(c.Origin.X), float64(c.Origin.Y)
+	sx, sy := aspect(c.Width, c.Height)
+	maxRadius := coverRadius(cx, cy, c.Width, c.Height, sx, sy)
+	for radius := 1.0; radius < maxRadius+5; radius += 5 {
+		ring := make([]point, 0, 512)
+		for _, pt := range newEllipse(cx, cy, sx*radius, sy*radius, 512).positions() {
+			if inCanvas(pt, c.Width, c.Height) {
+				ring = append(ring, pt)
+			}
+		}
+		if len(ring) > 0 {
+			p.rings = append(p.rings, ring)
+		}
+	}
+}
+
+func (p *CirclePlacer) Place(ctx context.Context, _ Footprint, fits FitFunc) (float64, float64, bool) {
+	return searchRings(ctx, p.rings, fits)
+}
+
+// ArchimedeanPlacer tries positions on an Archimedean spiral starting at the canvas origin, like d3-cloud.
+// The spiral is stretched with the aspect ratio of the canvas.
+type ArchimedeanPlacer struct {
+	// Distance between turns of the spiral, in pixels. Defaults to 5.
+	Step  float64
+	rings [][]point
+}
+
+func (p *ArchimedeanPlacer) Init(c Canvas) {
+	step := p.Step
+	if step <= 0 {
+		step = 5
+	}
+	p.rings = chunk(archimedeanSpiral(float64(c.Origin.X), float64(c.Origin.Y), c.Width, c.Height, step), spiralChunk)
+}
+
+func (p *ArchimedeanPlacer) Place(ctx context.Context, _ Footprint, fits FitFunc) (float64, float64, bool) {
+	return searchRings(ctx, p.rings, fits)
+}
+
+// RectangularPlacer tries positions on a rectangular spiral starting at the canvas origin, like d3-cloud.
+// The spiral follows the aspect ratio of the canvas, so that wide or tall images are filled up to the corners.
+type RectangularPlacer struct {
+	// Vertical distance between turns of the spiral, in pixels. Defaults to 4.
+	Step  float64
+	rings [][]point
+}
+
+func (p *RectangularPlacer) Init(c Canvas) {
+	step := p.Step
+	if step <= 0 {
+		step = 4
+	}
+	p.rings = chunk(rectangularSpiral(float64(c.Origin.X), float64(c.Origin.Y), c.Width, c.Height, step), spiralChunk)
+}
+
+func (p *RectangularPlacer) Place(ctx context.Context, _ Footprint, fits FitFunc) (float64, float64, bool) {
+	return searchRings(ctx, p.rings, fits)
+}
+
+// RandomPlacer tries random positions anywhere on the canvas. It is quite slow.
+type RandomPlacer struct {
+	// Max number of positions tried for each word. Defaults to 5000000.
+	Tries  int
+	canvas Canvas
+}
+
+func (p *RandomPlacer) Init(c Canvas) {
+	p.canvas = c
+}
+
+func (p *RandomPlacer) Place(ctx context.Context, _ Footprint, fits FitFunc) (x float64, y float64, space bool) {
+	maxTries := p.Tries
+	if maxTries <= 0 {
+		maxTries = 5000000
+	}
+	tries := 0
+	searching := true
+	for searching && tries < maxTries {
+		tries++
+		if tries%1024 == 0 && ctx.Err() != nil {
+			return
+		}
+		x, y = float64(p.canvas.Rand.Intn(p.canvas.Width)), float64(p.canvas.Rand.Intn(p.canvas.Height))
+		// Is that position available?
+		if fits(x, y) {
+			space = true
+			searching = false
+			return
+		}
+	}
+	return
+}
+
+// Data sent to placement workers
+type workerData struct {
+	ring      int
+	positions []point
+	fits      FitFunc
+}
+
+// Results sent from placement workers
+type res struct {
+	ring   int
+	x      float64
+	y      float64
+	failed bool
+}
+
+// Multithreaded word placement.
+// searchRings tests the rings of positions in parallel and returns the first position that fits, in ring order.
+func searchRings(ctx context.Context, rings [][]point, fits FitFunc) (x float64, y float64, space bool) {
+	space = false
+	if len(rings) == 0 {
+		return
+	}
+
+	stopSendingCh := make(chan struct{}, 1)
+	aggCh := make(chan res, 100)
+	workCh := make(chan workerData, runtime.NumCPU())
+	results := make(map[int]res)
+	done := make(map[int]bool)
+	stopChannels := make([]chan struct{}, 0)
+	wg := sync.WaitGroup{}
+
+	// Start workers that will test each one "ring" of positions
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		stopCh := make(chan struct{}, 1)
+		go func(ch chan struct{}, i int) {
+			defer wg.Done()
+			for {
+				select {
+				// Receive data
+				case d, ok := <-workCh:
+					if !ok {
+						return
+					}
+					// Test the positions and post results on aggCh
+					aggCh <- testRing(d.ring, d.positions, d.fits)
+				case <-ch:
+					// Stop signal
+					return
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(stopCh, i)
+		stopChannels = append(stopChannels, stopCh)
+	}
+
+	// Post positions to test to worker channel
+	go func() {
+		for i, positions := range rings {
+			select {
+			case <-stopSendingCh:
+				// Stop sending data immediately if a position has already been found
+				close(workCh)
+				return
+			case <-ctx.Done():
+				close(workCh)
+				return
+			case workCh <- workerData{
+				ring:      i,
+				positions: positions,
+				fits:      fits,
+			}:
+			}
+		}
+		// Close channel after all positions have been sent
+		close(workCh)
+	}()
+
+	defer func() {
+		// Stop data sending
+		stopSendingCh <- struct{}{}
+		// Tell the worker goroutines to stop
+		for _, c := range stopChannels {
+			c <- struct{}{}
+		}
+		// Purge res channel in case some workers are still sending data
+		go func() {
+			for {
+				select {
+				case <-aggCh:
+				default:
+					return
+				}
+			}
+		}()
+
+		// Wait for all goroutines to stop. We want to wait for them so that no thread is accessing internal data structs
+		// such as the spatial hashmap
+		wg.Wait()
+	}()
+
+	// Finally, aggregate the results coming from workers
+	for {
+		var d res
+		select {
+		case d = <-aggCh:
+		case <-ctx.Done():
+			return
+		}
+		results[d.ring] = d
+		done[d.ring] = true
+		//check if we need to continue
+		failed := true
+		// Example: if we know that there's a successful placement on ring 10 but have not received results for
+		// ring 5, we need to wait as there might be a closer successful position
+		for r := range rings {
+			if !done[r] {
+				// Some positions are not done. They might be successful
+				failed = false
+				break
+			}
+			// We have the successful placement with the lowest ring
+			if !results[r].failed {
+				return results[r].x, results[r].y, true
+			}
+		}
+
+		// We tried it all but could not place the word
+		if failed {
+			return
+		}
+	}
+}
+
+// test a series of points on a ring and returns as soon as there's a match
+func testRing(ring int, points []point, fits FitFunc) res {
+	var x, y float64
+
+	for _, p := range points {
+		y = p.y
+		x = p.x
+
+		// Is that position available?
+		if fits(x, y) {
+			return res{
+				x:      x,
+				y:      y,
+				failed: false,
+				ring:   ring,
+			}
+		}
+	}
+	return res{
+		x:      x,
+		y:      y,
+		failed: true,
+		ring:   ring,
+	}
+}
@@ -0,0 +1,24 @@
+package wordclouds
+
+import "math/rand"
+
+// rotation function returning the angle in degrees, clockwise, of a word given its rank in the word list.
+// Random choices must be drawn from rng so that seeded layouts are reproducible.
+type rotationFunction func(rng *rand.Rand, word string, rank int) float64
+
+// rotateAmong picks one of the angles at random for each word
+func rotateAmong(angles []float64) rotationFunction {
+	return func(rng *rand.Rand, _ string, _ int) float64 {
+		return angles[rng.Intn(len(angles))]
+	}
+}
+
+// rotateVertical turns words vertical, reading bottom to top, with probability p
+func rotateVertical(p float64) rotationFunction {
+	return func(rng *rand.Rand, _ string, _ int) float64 {
+		if rng.Float64() < p {
+			return -90
+		}
+		return 0
+	}
+}
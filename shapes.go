@@ -0,0 +1,344 @@
+package wordclouds
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+)
+
+// Shape is a region of the canvas where words are allowed. Shapes are scaled to the canvas, keeping their aspect
+// ratio, and centered. Use ShapeMask to get the corresponding mask.
+type Shape struct {
+	draw func(dc *gg.Context, width float64, height float64)
+}
+
+// Image renders the shape in black on a transparent width x height image
+func (s Shape) Image(width int, height int) image.Image {
+	dc := gg.NewContext(width, height)
+	dc.SetRGB(0, 0, 0)
+	s.draw(dc, float64(width), float64(height))
+	return dc.Image()
+}
+
+// ShapeMask creates a slice of box structs to be passed to wordclouds.MaskBoxes, masking everything outside of
+// the shape. The returned error is a *MaskError.
+func ShapeMask(s Shape, width int, height int) ([]*Box, error) {
+	if width <= 0 || height <= 0 {
+		return nil, &MaskError{Err: fmt.Errorf("canvas size must be positive, got %dx%d", width, height)}
+	}
+	return MaskFromImageFunc(s.Image(width, height), width, height, ExcludeAlphaBelow(128))
+}
+
+// CircleShape is the largest circle that fits in the canvas
+func CircleShape() Shape {
+	return Shape{draw: func(dc *gg.Context, width float64, height float64) {
+		dc.DrawCircle(width/2, height/2, math.Min(width, height)/2)
+		dc.Fill()
+	}}
+}
+
+// EllipseShape is the ellipse inscribed in the canvas
+func EllipseShape() Shape {
+	return Shape{draw: func(dc *gg.Context, width float64, height float64) {
+		dc.DrawEllipse(width/2, height/2, width/2, height/2)
+		dc.Fill()
+	}}
+}
+
+// RoundedRectShape is the whole canvas with corners rounded by radius pixels
+func RoundedRectShape(radius float64) Shape {
+	return Shape{draw: func(dc *gg.Context, width float64, height float64) {
+		dc.DrawRoundedRectangle(0, 0, width, height, radius)
+		dc.Fill()
+	}}
+}
+
+// HeartShape is a heart
+func HeartShape() Shape {
+	pts := make([]point, 0, 256)
+	for i := 0; i < 256; i++ {
+		t := 2 * math.Pi * float64(i) / 256
+		pts = append(pts, point{
+			x: 16 * math.Pow(math.Sin(t), 3),
+			y: -(13*math.Cos(t) - 5*math.Cos(2*t) - 2*math.Cos(3*t) - math.Cos(4*t)),
+		})
+	}
+	return pathShape([][]point{pts})
+}
+
+// StarShape is a star with the given number of points, at least 2, pointing up. inner is the radius of the inner
+// vertices relative to the outer ones, strictly between 0 and 1. The returned error is a *MaskError.
+func StarShape(points int, inner float64) (Shape, error) {
+	if points < 2 {
+		return Shape{}, &MaskError{Err: fmt.Errorf("a star needs at least 2 points, got %d", points)}
+	}
+	if !(inner > 0 && inner < 1) {
+		return Shape{}, &MaskError{Err: fmt.Errorf("inner radius must be between 0 and 1, got %v", inner)}
+	}
+	pts := make([]point, 0, 2*points)
+	for i := 0; i < 2*points; i++ {
+		r := 1.0
+		if i%2 == 1 {
+			r = inner
+		}
+		a := math.Pi*float64(i)/float64(points) - math.Pi/2
+		pts = append(pts, point{x: r * math.Cos(a), y: r * math.Sin(a)})
+	}
+	return pathShape([][]point{pts}), nil
+}
+
+// PolygonShape is a regular polygon with the given number of sides, at least 3, with a vertex pointing up.
+// The returned error is a *MaskError.
+func PolygonShape(sides int) (Shape, error) {
+	if sides < 3 {
+		return Shape{}, &MaskError{Err: fmt.Errorf("a polygon needs at least 3 sides, got %d", sides)}
+	}
+	pts := make([]point, 0, sides)
+	for i := 0; i < sides; i++ {
+		a := 2*math.Pi*float64(i)/float64(sides) - math.Pi/2
+		pts = append(pts, point{x: math.Cos(a), y: math.Sin(a)})
+	}
+	return pathShape([][]point{pts}), nil
+}
+
+// TextShape is the letters of text drawn as large as possible with font, so that words fill the letters.
+// The returned error is a *FontError.
+func TextShape(text string, src FontSource) (Shape, error) {
+	tf, err := src.load()
+	if err != nil {
+		return Shape{}, err
+	}
+	return Shape{draw: func(dc *gg.Context, width float64, height float64) {
+		// Measure the ink at a reference size, then scale the font to fit the canvas
+		size := 100.0
+		b, _ := font.BoundString(tf.face(size), text)
+		w, h := float64(b.Max.X-b.Min.X)/64, float64(b.Max.Y-b.Min.Y)/64
+		if w <= 0 || h <= 0 {
+			return
+		}
+		size *= math.Min(width/w, height/h)
+		face := tf.face(size)
+		b, _ = font.BoundString(face, text)
+		dc.SetFontFace(face)
+		dc.DrawString(text, width/2-float64(b.Min.X+b.Max.X)/128, height/2-float64(b.Min.Y+b.Max.Y)/128)
+	}}, nil
+}
+
+// SVGPathShape is the region filled by an SVG path, such as the d attribute of a <path> element.
+// Lines, cubic and quadratic curves are supported, arcs are not. Subpaths are filled with the nonzero rule.
+func SVGPathShape(d string) (Shape, error) {
+	paths, err := parseSVGPath(d)
+	if err != nil {
+		return Shape{}, &MaskError{Err: err}
+	}
+	if len(paths) == 0 {
+		return Shape{}, &MaskError{Err: errors.New("empty SVG path")}
+	}
+	return pathShape(paths), nil
+}
+
+// pathShape fills closed paths, scaled to fit the canvas and centered
+func pathShape(paths [][]point) Shape {
+	b := Box{Top: math.Inf(-1), Left: math.Inf(1), Right: math.Inf(-1), Bottom: math.Inf(1)}
+	for _, path := range paths {
+		for _, p := range path {
+			b.Left, b.Right = math.Min(b.Left, p.x), math.Max(b.Right, p.x)
+			b.Bottom, b.Top = math.Min(b.Bottom, p.y), math.Max(b.Top, p.y)
+		}
+	}
+	return Shape{draw: func(dc *gg.Context, width float64, height float64) {
+		if b.w() <= 0 || b.h() <= 0 {
+			return
+		}
+		scale := math.Min(width/b.w(), height/b.h())
+		dx := (width-scale*b.w())/2 - scale*b.Left
+		dy := (height-scale*b.h())/2 - scale*b.Bottom
+		for _, path := range paths {
+			for i, p := range path {
+				if i == 0 {
+					dc.MoveTo(scale*p.x+dx, scale*p.y+dy)
+				} else {
+					dc.LineTo(scale*p.x+dx, scale*p.y+dy)
+				}
+			}
+			dc.ClosePath()
+		}
+		dc.SetFillRule(gg.FillRuleWinding)
+		dc.Fill()
+	}}
+}
+
+var svgPathToken = regexp.MustCompile(`[A-Za-z]|[-+]?(?:\d*\.\d+|\d+\.?)(?:[eE][-+]?\d+)?`)
+
+// Number of segments used to flatten curves
+const curveSegments = 16
+
+// parseSVGPath flattens the subpaths of an SVG path into polygons
+func parseSVGPath(d string) ([][]point, error) {
+	tokens := svgPathToken.FindAllString(d, -1)
+	// Anything else than separators between tokens is invalid
+	if rest := strings.Trim(svgPathToken.ReplaceAllString(d, ""), " ,\t\r\n"); rest != "" {
+		return nil, fmt.Errorf("invalid SVG path near %q", rest)
+	}
+
+	var paths [][]point
+	var cur []point
+	var pos, start, ctrl point
+	var cmd, prev byte
+	i := 0
+	args := func(n int) ([]float64, error) {
+		if i+n > len(tokens) {
+			return nil, fmt.Errorf("missing arguments for SVG path command %c", cmd)
+		}
+		res := make([]float64, n)
+		for k := range res {
+			v, err := strconv.ParseFloat(tokens[i+k], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid SVG path command %c: %v", cmd, err)
+			}
+			res[k] = v
+		}
+		i += n
+		return res, nil
+	}
+	flush := func() {
+		if len(cur) > 2 {
+			paths = append(paths, cur)
+		}
+		cur = nil
+	}
+	for i < len(tokens) {
+		if c := tokens[i][0]; (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') {
+			cmd = c
+			i++
+		} else if cmd == 0 || cmd|0x20 == 'z' {
+			return nil, fmt.Errorf("unexpected SVG path argument %s", tokens[i])
+		}
+		if cur == nil && cmd|0x20 != 'm' {
+			// Drawing after a closed subpath starts from its first point
+			cur = []point{pos}
+		}
+		rel := cmd >= 'a'
+		abs := func(x float64, y float64) point {
+			if rel {
+				return point{x: pos.x + x, y: pos.y + y}
+			}
+			return point{x: x, y: y}
+		}
+		switch cmd | 0x20 {
+		case 'm':
+			a, err := args(2)
+			if err != nil {
+				return nil, err
+			}
+			flush()
+			pos = abs(a[0], a[1])
+			start = pos
+			cur = []point{pos}
+			// Further coordinate pairs are implicit line commands
+			cmd = 'L' | (cmd & 0x20)
+		case 'l':
+			a, err := args(2)
+			if err != nil {
+				return nil, err
+			}
+			pos = abs(a[0], a[1])
+			cur = append(cur, pos)
+		case 'h':
+			a, err := args(1)
+			if err != nil {
+				return nil, err
+			}
+			if rel {
+				pos.x += a[0]
+			} else {
+				pos.x = a[0]
+			}
+			cur = append(cur, pos)
+		case 'v':
+			a, err := args(1)
+			if err != nil {
+				return nil, err
+			}
+			if rel {
+				pos.y += a[0]
+			} else {
+				pos.y = a[0]
+			}
+			cur = append(cur, pos)
+		case 'c', 's':
+			n := 6
+			if cmd|0x20 == 's' {
+				n = 4
+			}
+			a, err := args(n)
+			if err != nil {
+				return nil, err
+			}
+			c1 := pos
+			if cmd|0x20 == 's' {
+				// The first control point is the reflection of the previous one
+				if prev|0x20 == 'c' || prev|0x20 == 's' {
+					c1 = point{x: 2*pos.x - ctrl.x, y: 2*pos.y - ctrl.y}
+				}
+				a = append([]float64{0, 0}, a...)
+			} else {
+				c1 = abs(a[0], a[1])
+			}
+			c2, end := abs(a[2], a[3]), abs(a[4], a[5])
+			for k := 1; k <= curveSegments; k++ {
+				t := float64(k) / curveSegments
+				u := 1 - t
+				cur = append(cur, point{
+					x: u*u*u*pos.x + 3*u*u*t*c1.x + 3*u*t*t*c2.x + t*t*t*end.x,
+					y: u*u*u*pos.y + 3*u*u*t*c1.y + 3*u*t*t*c2.y + t*t*t*end.y,
+				})
+			}
+			ctrl, pos = c2, end
+		case 'q', 't':
+			var c point
+			var end point
+			if cmd|0x20 == 't' {
+				a, err := args(2)
+				if err != nil {
+					return nil, err
+				}
+				c = pos
+				if prev|0x20 == 'q' || prev|0x20 == 't' {
+					c = point{x: 2*pos.x - ctrl.x, y: 2*pos.y - ctrl.y}
+				}
+				end = abs(a[0], a[1])
+			} else {
+				a, err := args(4)
+				if err != nil {
+					return nil, err
+				}
+				c, end = abs(a[0], a[1]), abs(a[2], a[3])
+			}
+			for k := 1; k <= curveSegments; k++ {
+				t := float64(k) / curveSegments
+				u := 1 - t
+				cur = append(cur, point{
+					x: u*u*pos.x + 2*u*t*c.x + t*t*end.x,
+					y: u*u*pos.y + 2*u*t*c.y + t*t*end.y,
+				})
+			}
+			ctrl, pos = c, end
+		case 'z':
+			flush()
+			pos = start
+		default:
+			return nil, fmt.Errorf("unsupported SVG path command %c", cmd)
+		}
+		prev = cmd
+	}
+	flush()
+	return paths, nil
+}
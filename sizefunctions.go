@@ -1,15 +1,20 @@
 package wordclouds
 
-import "math"
+import (
+	"fmt"
+	"math"
+)
 
 const (
 	SizeFunctionLinear      = "linear"
 	SizeFunctionSqrt        = "sqrt"
 	SizeFunctionSqrtInverse = "sqrtinverse"
+	SizeFunctionLog         = "log"
 )
 
-// size function to work on a normalized interval [0:1]
-type sizeFunction func(x float64) float64
+// SizeFunc maps the weight of a word, relative to the most frequent word, to its font size relative to
+// FontMaxSize. Both are in the normalized interval [0:1].
+type SizeFunc func(x float64) float64
 
 // sizeLinear scales font 1:1
 func sizeLinear(x float64) float64 {
@@ -25,3 +30,33 @@ func sizeSqrt(x float64) float64 {
 func sizeSqrtInverse(x float64) float64 {
 	return 1 - math.Sqrt(1-x)
 }
+
+// sizeLog scales based on log10(1+9x), a word with a tenth of the top count gets more than a quarter of the size
+func sizeLog(x float64) float64 {
+	return math.Log10(1 + 9*x)
+}
+
+// sizePower scales based on x^exponent, exponents below 1 meaning larger fonts earlier
+func sizePower(exponent float64) SizeFunc {
+	return func(x float64) float64 {
+		return math.Pow(x, exponent)
+	}
+}
+
+// scale applies f to x, clamping the result to [0:1]. It returns an error if the result is not a number.
+func (f SizeFunc) scale(x float64) (float64, error) {
+	y := f(x)
+	if math.IsNaN(y) {
+		return 0, &OptionError{Option: "SizeFunction", Reason: fmt.Sprintf("returned %v for %v", y, x)}
+	}
+	return math.Max(0, math.Min(y, 1)), nil
+}
+
+// rankPosition returns the position of a word in [0:1] given its rank among n words, 1 for the first one.
+// Words with the same weight share the rank of the first of them.
+func rankPosition(rank int, n int) float64 {
+	if n <= 1 {
+		return 1
+	}
+	return 1 - float64(rank)/float64(n-1)
+}
@@ -1,16 +1,7 @@
 package wordclouds
 
-import (
-	"github.com/google/uuid"
-)
-
-type uniqueBox struct {
-	uuid.UUID
-	b *Box
-}
-
 type spatialHashMap struct {
-	mat      [][][]*uniqueBox
+	mat      [][][]*Box
 	rw       float64
 	rh       float64
 	gridSize int
@@ -21,9 +12,9 @@ func (s *spatialHashMap) TestCollision(b *Box, test func(a *Box, b *Box) bool) (
 	top, left, right, bottom := s.toGridCoords(b)
 	for i := left; i <= right; i++ {
 		for j := bottom; j <= top; j++ {
-			for _, ub := range s.mat[i][j] {
+			for _, cb := range s.mat[i][j] {
 				overlaps++
-				if test(ub.b, b) {
+				if test(cb, b) {
 					return true, overlaps
 				}
 			}
@@ -33,11 +24,10 @@ func (s *spatialHashMap) TestCollision(b *Box, test func(a *Box, b *Box) bool) (
 }
 
 func (s *spatialHashMap) Add(b *Box) {
-	id := uuid.New()
 	top, left, right, bottom := s.toGridCoords(b)
 	for i := left; i <= right; i++ {
 		for j := bottom; j <= top; j++ {
-			s.mat[i][j] = append(s.mat[i][j], &uniqueBox{id, b})
+			s.mat[i][j] = append(s.mat[i][j], b)
 		}
 	}
 }
@@ -46,11 +36,11 @@ func newSpatialHashMap(windowWidth float64, windowHeight float64, gridSize int)
 	rw := windowWidth / float64(gridSize)
 	rh := windowHeight / float64(gridSize)
 
-	mat := make([][][]*uniqueBox, gridSize)
+	mat := make([][][]*Box, gridSize)
 	for i := 0; i < gridSize; i++ {
-		mat[i] = make([][]*uniqueBox, gridSize)
+		mat[i] = make([][]*Box, gridSize)
 		for j := 0; j < gridSize; j++ {
-			mat[i][j] = make([]*uniqueBox, 0)
+			mat[i][j] = make([]*Box, 0)
 		}
 	}
 
@@ -69,6 +59,13 @@ func min(a int, b int) int {
 	return b
 }
 
+func max(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
 func (s *spatialHashMap) toGridCoords(b *Box) (int, int, int, int) {
-	return min(int(b.Top/s.rh), s.gridSize-1), int(b.Left / s.rw), min(int(b.Right/s.rw), s.gridSize-1), int(b.Bottom / s.rh)
+	return min(int(b.Top/s.rh), s.gridSize-1), max(int(b.Left/s.rw), 0), min(int(b.Right/s.rw), s.gridSize-1), max(int(b.Bottom/s.rh), 0)
 }
@@ -0,0 +1,77 @@
+package wordclouds
+
+import "math"
+
+// Number of spiral points tested by each placement worker
+const spiralChunk = 256
+
+// archimedeanSpiral returns the points of a spiral starting at cx, cy with step pixels between turns, until it
+// covers a width x height canvas. The spiral is stretched along the longer side of the canvas.
+// Points are about 2px apart, and at most 512 per turn.
+func archimedeanSpiral(cx float64, cy float64, width int, height int, step float64) []point {
+	sx, sy := aspect(width, height)
+	maxRadius := coverRadius(cx, cy, width, height, sx, sy)
+
+	pts := make([]point, 0)
+	for theta := 0.0; ; {
+		r := step * theta / (2 * math.Pi)
+		if r > maxRadius {
+			break
+		}
+		p := point{x: cx + sx*r*math.Cos(theta), y: cy + sy*r*math.Sin(theta)}
+		if inCanvas(p, width, height) {
+			pts = append(pts, p)
+		}
+		theta += math.Max(math.Min(2/(r*math.Max(sx, sy)), 1), 2*math.Pi/512)
+	}
+	return pts
+}
+
+// rectangularSpiral returns the points of a rectangular spiral starting at cx, cy, until it covers a
+// width x height canvas. Consecutive points are step pixels apart vertically and step*width/height pixels apart
+// horizontally, so the spiral follows the aspect ratio of the canvas.
+func rectangularSpiral(cx float64, cy float64, width int, height int, step float64) []point {
+	dy := step
+	dx := step * float64(width) / float64(height)
+	x, y := cx, cy
+	minX, maxX, minY, maxY := x, x, y, y
+
+	pts := []point{{x: x, y: y}}
+	for t := 1; minX > 0 || maxX < float64(width) || minY > 0 || maxY < float64(height); t++ {
+		// Same walk as d3-cloud: legs of 1, 1, 2, 2, 3, 3... steps turning clockwise
+		switch (int(math.Sqrt(float64(1+4*t))) - 1) & 3 {
+		case 0:
+			x += dx
+		case 1:
+			y += dy
+		case 2:
+			x -= dx
+		default:
+			y -= dy
+		}
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+		p := point{x: x, y: y}
+		if inCanvas(p, width, height) {
+			pts = append(pts, p)
+		}
+	}
+	return pts
+}
+
+func inCanvas(p point, width int, height int) bool {
+	return p.x >= 0 && p.y >= 0 && p.x <= float64(width) && p.y <= float64(height)
+}
+
+// chunk splits points in consecutive slices of at most n points, so that they can be searched as rings
+func chunk(points []point, n int) [][]point {
+	chunks := make([][]point, 0, len(points)/n+1)
+	for len(points) > n {
+		chunks = append(chunks, points[:n])
+		points = points[n:]
+	}
+	if len(points) > 0 {
+		chunks = append(chunks, points)
+	}
+	return chunks
+}
@@ -0,0 +1,74 @@
+package wordclouds
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DrawSVG places the words exactly like Draw and writes the result to out as an SVG document. Like Draw, it starts
+// the layout over after a cancelled DrawContext.
+// Each placed word becomes one <text> element, so the cloud stays sharp at any zoom level. Words with a URL are
+// wrapped in a link.
+func (w *Wordcloud) DrawSVG(out io.Writer) error {
+	if w.layoutErr != nil {
+		w.restart()
+	}
+	if err := w.layout(context.Background()); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(out)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		w.opts.Width, w.opts.Height, w.opts.Width, w.opts.Height)
+	if _, _, _, a := w.opts.BackgroundColor.RGBA(); a != 0 {
+		fmt.Fprintf(bw, `<rect width="100%%" height="100%%"%s/>`+"\n", svgFill(w.opts.BackgroundColor))
+	}
+
+	for _, p := range w.placements {
+		transform := ""
+		if p.rotation != 0 {
+			transform = fmt.Sprintf(` transform="rotate(%s %s %s)"`, svgNumber(p.rotation), svgNumber(p.x), svgNumber(p.y))
+		}
+		if p.url != "" {
+			fmt.Fprintf(bw, `<a href="%s">`, svgEscape(p.url))
+		}
+		fmt.Fprintf(bw, `<text x="%s" y="%s" font-family="%s" font-size="%s" text-anchor="middle"%s%s>%s</text>`,
+			svgNumber(p.x), svgNumber(p.baseline), svgEscape(p.family), svgNumber(p.size), svgFill(p.color), transform,
+			svgEscape(p.word))
+		if p.url != "" {
+			fmt.Fprint(bw, "</a>")
+		}
+		fmt.Fprintln(bw)
+	}
+
+	fmt.Fprintln(bw, "</svg>")
+	return bw.Flush()
+}
+
+// svgFill returns the fill attributes for c, including fill-opacity for translucent colors
+func svgFill(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	attrs := fmt.Sprintf(` fill="#%02x%02x%02x"`, n.R, n.G, n.B)
+	if n.A != 0xff {
+		attrs += ` fill-opacity="` + svgNumber(float64(n.A)/0xff) + `"`
+	}
+	return attrs
+}
+
+// svgNumber formats v with at most two decimals
+func svgNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+func svgEscape(s string) string {
+	var sb strings.Builder
+	_ = xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
@@ -0,0 +1,89 @@
+package tokenizer
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/cases"
+)
+
+//go:embed stopwords/*.txt
+var embeddedStopwords embed.FS
+
+// StopwordList is a set of case folded words to ignore when counting
+type StopwordList map[string]struct{}
+
+// StopwordLanguages returns the languages with a built-in stopword list, as ISO 639-1 codes
+func StopwordLanguages() []string {
+	entries, _ := embeddedStopwords.ReadDir("stopwords")
+	res := make([]string, 0, len(entries))
+	for _, e := range entries {
+		res = append(res, strings.TrimSuffix(e.Name(), ".txt"))
+	}
+	sort.Strings(res)
+	return res
+}
+
+// StopwordsFor returns the built-in stopword list of a language given as an ISO 639-1 code, such as "en" or "fr".
+func StopwordsFor(language string) (StopwordList, error) {
+	f, err := embeddedStopwords.Open("stopwords/" + language + ".txt")
+	if err != nil {
+		return nil, fmt.Errorf("tokenizer: no stopwords for language %q, available: %s",
+			language, strings.Join(StopwordLanguages(), ", "))
+	}
+	defer f.Close()
+	return ReadStopwords(f)
+}
+
+// LoadStopwords reads a stopword list from a file. See ReadStopwords for the format.
+func LoadStopwords(path string) (StopwordList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadStopwords(f)
+}
+
+// ReadStopwords reads a stopword list with one word per line. Empty lines and lines starting with # are ignored.
+func ReadStopwords(r io.Reader) (StopwordList, error) {
+	res := make(StopwordList)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		res[foldStopword(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Merge returns a new list containing the words of all the lists
+func (s StopwordList) Merge(others ...StopwordList) StopwordList {
+	res := make(StopwordList, len(s))
+	for _, list := range append([]StopwordList{s}, others...) {
+		for word := range list {
+			res[word] = struct{}{}
+		}
+	}
+	return res
+}
+
+// Contains reports whether word is a stopword, regardless of its case
+func (s StopwordList) Contains(word string) bool {
+	_, ok := s[foldStopword(word)]
+	return ok
+}
+
+func foldStopword(word string) string {
+	return cases.Fold().String(strings.ReplaceAll(word, "’", "'"))
+}
@@ -0,0 +1,314 @@
+// Package tokenizer builds word frequency maps from raw text. The maps can be passed straight to
+// wordclouds.NewWordcloud.
+package tokenizer
+
+import (
+	"bufio"
+	"io"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+type Options struct {
+	MinLength     int
+	KeepNumbers   bool
+	CaseSensitive bool
+	Stopwords     StopwordList
+
+	// err records an invalid option value, reported by Tokenize
+	err error
+}
+
+var defaultOptions = Options{
+	MinLength:     2,
+	KeepNumbers:   false,
+	CaseSensitive: false,
+}
+
+type Option func(*Options)
+
+// Minimum number of characters of a word. Shorter words are dropped, except the characters of scripts written without
+// spaces.
+func MinLength(n int) Option {
+	return func(options *Options) {
+		options.MinLength = n
+	}
+}
+
+// Keep words made of digits only, such as years. They are dropped by default.
+func KeepNumbers() Option {
+	return func(options *Options) {
+		options.KeepNumbers = true
+	}
+}
+
+// Do not fold the case of words
+func CaseSensitive() Option {
+	return func(options *Options) {
+		options.CaseSensitive = true
+	}
+}
+
+// Ignore the words of the built-in stopword lists of the given languages. See StopwordLanguages.
+// Can be combined with Stopwords.
+func Languages(languages ...string) Option {
+	return func(options *Options) {
+		for _, language := range languages {
+			list, err := StopwordsFor(language)
+			if err != nil {
+				options.err = err
+				return
+			}
+			options.Stopwords = options.Stopwords.Merge(list)
+		}
+	}
+}
+
+// Ignore the words of custom stopword lists, for instance loaded with LoadStopwords.
+// Can be combined with Languages.
+func Stopwords(lists ...StopwordList) Option {
+	return func(options *Options) {
+		options.Stopwords = options.Stopwords.Merge(lists...)
+	}
+}
+
+// Count splits the text read from r into words and counts their occurrences. Unless CaseSensitive is set, words
+// that only differ once their case is folded, such as "straße" and "strasse", are counted together under their most
+// frequent form.
+func Count(r io.Reader, options ...Option) (map[string]int, error) {
+	opts, err := newOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	// Occurrences of each form of a word, by folded word
+	forms := make(map[string]map[string]int)
+	err = tokenize(r, opts, func(word string) {
+		key := word
+		if !opts.CaseSensitive {
+			key = cases.Fold().String(word)
+		}
+		if forms[key] == nil {
+			forms[key] = make(map[string]int)
+		}
+		forms[key][word]++
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(forms))
+	for _, f := range forms {
+		best, total := "", 0
+		for form, n := range f {
+			total += n
+			if n > f[best] || (n == f[best] && form < best) {
+				best = form
+			}
+		}
+		counts[best] = total
+	}
+	return counts, nil
+}
+
+// Tokenize splits the text read from r into words and calls fn for each word that passes the filters.
+//
+// Words are runs of letters, marks and digits. Apostrophes, hyphens and underscores are kept inside words, as in
+// "don't" or "state-of-the-art", and any other punctuation separates words. Scripts written without spaces, such
+// as Chinese, Japanese and Thai, have no word boundaries to find: each character is a word on its own.
+// Runs longer than 1024 bytes, such as base64 data, are skipped. Words are lowercased unless CaseSensitive is set.
+func Tokenize(r io.Reader, fn func(word string), options ...Option) error {
+	opts, err := newOptions(options)
+	if err != nil {
+		return err
+	}
+	return tokenize(r, opts, fn)
+}
+
+func newOptions(options []Option) (Options, error) {
+	opts := defaultOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+	return opts, opts.err
+}
+
+func tokenize(r io.Reader, opts Options, fn func(word string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Split((&splitter{}).split)
+	for scanner.Scan() {
+		word, ok := opts.normalize(scanner.Text())
+		if ok {
+			fn(word)
+		}
+	}
+	return scanner.Err()
+}
+
+// normalize lowercases a word and reports whether it passes the filters
+func (o *Options) normalize(word string) (string, bool) {
+	r, _ := utf8.DecodeRuneInString(word)
+	if utf8.RuneCountInString(word) < o.MinLength && !isUnspaced(r) {
+		return "", false
+	}
+	if !o.KeepNumbers && isNumber(word) {
+		return "", false
+	}
+	if o.Stopwords.Contains(word) {
+		return "", false
+	}
+	if !o.CaseSensitive {
+		// Unlike folding, lowering keeps the final sigma and ß, so that the word is spelled right in the cloud
+		word = cases.Lower(language.Und).String(word)
+	}
+	return word, true
+}
+
+func isNumber(word string) bool {
+	for _, r := range word {
+		if !unicode.IsNumber(r) && !isJoiner(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsNumber(r)
+}
+
+// isJoiner reports whether r can join two parts of a word
+func isJoiner(r rune) bool {
+	switch r {
+	case '\'', '’', '-', '‐', '_':
+		return true
+	}
+	return false
+}
+
+// Scripts written without spaces between words
+var unspaced = []*unicode.RangeTable{
+	unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Thai, unicode.Lao, unicode.Khmer, unicode.Myanmar,
+}
+
+// isUnspaced reports whether r belongs to a script written without spaces between words
+func isUnspaced(r rune) bool {
+	return unicode.In(r, unspaced...)
+}
+
+// Runs of word characters longer than maxWordSize bytes are not words
+const maxWordSize = 1024
+
+// splitter drops the runs longer than maxWordSize returned by scanWords, so that they do not fill the scanner
+// buffer
+type splitter struct {
+	skipping bool
+}
+
+// split is a bufio.SplitFunc returning one word at a time
+func (s *splitter) split(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	skipped := 0
+	if s.skipping {
+		for skipped < len(data) {
+			if !utf8.FullRune(data[skipped:]) && !atEOF {
+				return skipped, nil, nil
+			}
+			r, size := utf8.DecodeRune(data[skipped:])
+			if !isWordRune(r) && !isJoiner(r) {
+				s.skipping = false
+				break
+			}
+			skipped += size
+		}
+		if s.skipping {
+			return skipped, nil, nil
+		}
+	}
+
+	advance, token, err = scanWords(data[skipped:], atEOF)
+	if token == nil && err == nil && len(data)-skipped-advance > maxWordSize {
+		// Skip the beginning of the run, up to a character boundary
+		s.skipping = true
+		advance += maxWordSize
+		for !utf8.RuneStart(data[skipped+advance]) {
+			advance--
+		}
+	}
+	return skipped + advance, token, err
+}
+
+// scanWords is a bufio.SplitFunc returning one word at a time
+func scanWords(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	// Skip separators
+	start := 0
+	for start < len(data) {
+		if !utf8.FullRune(data[start:]) && !atEOF {
+			return start, nil, nil
+		}
+		r, size := utf8.DecodeRune(data[start:])
+		if isWordRune(r) {
+			if isUnspaced(r) {
+				return scanCharacter(data, start, size, atEOF)
+			}
+			break
+		}
+		start += size
+	}
+
+	// Read the word
+	end := start
+	for end < len(data) {
+		if !utf8.FullRune(data[end:]) && !atEOF {
+			return start, nil, nil
+		}
+		r, size := utf8.DecodeRune(data[end:])
+		if isWordRune(r) && !isUnspaced(r) {
+			end += size
+			continue
+		}
+		if !isJoiner(r) {
+			return end, data[start:end], nil
+		}
+		// A joiner only belongs to the word if a letter follows
+		next := end + size
+		if next >= len(data) || !utf8.FullRune(data[next:]) {
+			if !atEOF {
+				return start, nil, nil
+			}
+			return end, data[start:end], nil
+		}
+		nr, _ := utf8.DecodeRune(data[next:])
+		if !isWordRune(nr) || isUnspaced(nr) {
+			return end, data[start:end], nil
+		}
+		end = next
+	}
+
+	if atEOF && end > start {
+		return end, data[start:end], nil
+	}
+	// Request more data
+	return start, nil, nil
+}
+
+// scanCharacter returns the character starting at start, along with the marks that follow it such as Thai vowels
+func scanCharacter(data []byte, start int, size int, atEOF bool) (advance int, token []byte, err error) {
+	end := start + size
+	for end < len(data) {
+		if !utf8.FullRune(data[end:]) && !atEOF {
+			return start, nil, nil
+		}
+		r, size := utf8.DecodeRune(data[end:])
+		if !unicode.IsMark(r) {
+			return end, data[start:end], nil
+		}
+		end += size
+	}
+	if !atEOF {
+		// A mark may follow
+		return start, nil, nil
+	}
+	return end, data[start:end], nil
+}
@@ -0,0 +1,117 @@
+package tokenizer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCount(t *testing.T) {
+	text := `The quick brown fox -- "don't" jump, the state-of-the-art FOX!
+In 2024, 3.14 foxes' friends met Ærøskøbing's fox & 東京 界. %f\n &box`
+
+	counts, err := Count(strings.NewReader(text))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{
+		"the":              2,
+		"quick":            1,
+		"brown":            1,
+		"fox":              3,
+		"don't":            1,
+		"jump":             1,
+		"state-of-the-art": 1,
+		"in":               1,
+		"foxes":            1,
+		"friends":          1,
+		"met":              1,
+		"ærøskøbing's":     1,
+		"box":              1,
+		"東":                1,
+		"京":                1,
+		"界":                1,
+	}, counts)
+}
+
+func TestCount_Options(t *testing.T) {
+	text := "In 2024 a Fox met a fox, 東京"
+
+	counts, err := Count(strings.NewReader(text), MinLength(1), KeepNumbers(), CaseSensitive())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{
+		"In":   1,
+		"2024": 1,
+		"a":    2,
+		"Fox":  1,
+		"met":  1,
+		"fox":  1,
+		"東":    1,
+		"京":    1,
+	}, counts)
+}
+
+func TestCount_LongInput(t *testing.T) {
+	// Words spanning the scanner buffer boundaries
+	text := strings.Repeat("état-major café ", 10000)
+
+	counts, err := Count(strings.NewReader(text))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"état-major": 10000, "café": 10000}, counts)
+
+	// Long runs without separators are skipped instead of filling the scanner buffer
+	text = "minified " + strings.Repeat("a", 200000) + " code " + strings.Repeat("é", 100000) + " end"
+	counts, err = Count(strings.NewReader(text))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"minified": 1, "code": 1, "end": 1}, counts)
+}
+
+func TestCount_Unspaced(t *testing.T) {
+	// Japanese and Thai are written without spaces, each character is counted with its marks
+	counts, err := Count(strings.NewReader("カタカナ ひらがな。ภาษาที่"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{
+		"カ": 2, "タ": 1, "ナ": 1, "ひ": 1, "ら": 1, "が": 1, "な": 1,
+		"ภ": 1, "า": 2, "ษ": 1, "ที่": 1,
+	}, counts)
+
+	// Words are counted by folded case and spelled with their most frequent lowercase form
+	counts, err = Count(strings.NewReader("Straße straße STRASSE ΣΊΣΥΦΟΣ σίσυφος"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"straße": 3, "σίσυφος": 2}, counts)
+
+	words := make([]string, 0)
+	assert.NoError(t, Tokenize(strings.NewReader("ΣΊΣΥΦΟΣ STRASSE"), func(word string) {
+		words = append(words, word)
+	}))
+	assert.Equal(t, []string{"σίσυφος", "strasse"}, words)
+}
+
+func TestCount_Stopwords(t *testing.T) {
+	text := "The fox and the dog. Le renard et le chien. Der Fuchs und der Hund. Don’t panic, FOXES!"
+
+	custom, err := ReadStopwords(strings.NewReader("# animals\nfoxes\n\nDOG\n"))
+	assert.NoError(t, err)
+
+	counts, err := Count(strings.NewReader(text), Languages("en", "fr", "de"), Stopwords(custom))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{
+		"fox":    1,
+		"renard": 1,
+		"chien":  1,
+		"fuchs":  1,
+		"hund":   1,
+		"panic":  1,
+	}, counts)
+
+	_, err = Count(strings.NewReader(text), Languages("xx"))
+	assert.Error(t, err)
+}
+
+func TestStopwordLanguages(t *testing.T) {
+	assert.Equal(t, []string{"de", "en", "es", "fr", "it", "pt"}, StopwordLanguages())
+	for _, language := range StopwordLanguages() {
+		list, err := StopwordsFor(language)
+		assert.NoError(t, err)
+		assert.Greater(t, len(list), 100, language)
+	}
+}
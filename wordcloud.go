@@ -1,13 +1,13 @@
 package wordclouds
 
 import (
+	"context"
 	"image"
+	"image/color"
 	"math"
 	"math/rand"
-	"runtime"
 	"sort"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/fogleman/gg"
@@ -18,104 +18,194 @@ type wordCount struct {
 	word  string
 	count int
 	size  float64
+	rank  int
+	// count relative to the most frequent word
+	weight float64
+	// count relative to the least and most frequent words, from 0 to 1
+	spread float64
+	// index of the font override in Options.WordFonts, -1 for the font policy
+	font  int
+	entry *Word
+}
+
+// pinned reports whether the word has a fixed position
+func (wc wordCount) pinned() bool {
+	return wc.entry.Position != nil
+}
+
+// fixed reports whether the font size of the word was set explicitly and must not be scaled
+func (wc wordCount) fixed() bool {
+	return wc.entry.Size > 0
+}
+
+// placement records where and how a word was drawn so the layout can be replayed by other renderers
+type placement struct {
+	word     string
+	count    int
+	weight   float64
+	url      string
+	meta     map[string]interface{}
+	x        float64
+	y        float64
+	baseline float64
+	width    float64
+	height   float64
+	size     float64
+	family   string
+	rotation float64
+	color    color.Color
+	boxes    []*Box
 }
 
 // Wordcloud object. Create one with NewWordcloud and use Draw() to get the image
 type Wordcloud struct {
-	wordList        map[string]int
-	sortedWordList  []wordCount
-	grid            *spatialHashMap
-	dc              *gg.Context
-	randomPlacement bool
-	width           float64
-	height          float64
-	opts            Options
-	circles         map[float64]*circle
-	fonts           map[float64]font.Face
-	radii           []float64
+	sortedWordList []wordCount
+	grid           *spatialHashMap
+	occupancy      *occupancy
+	dc             *gg.Context
+	fonts          *fontSet
+	rng            *rand.Rand
+	seed           int64
+	placer         Placer
+	imageColors    *imageColors
+	width          float64
+	height         float64
+	opts           Options
+	placements     []placement
+	unplaced       []string
+	drawn          bool
+	layoutErr      error
+	// Number of unplaced words that are not pinned, the ones smaller fonts may fit
+	missed int
+	// Number of layout passes and scale of the font sizes in the last one
+	passes int
+	scale  float64
 }
 
 // Initialize a wordcloud based on a map of word frequency.
+// NewWordcloud panics if the options are invalid. Use New to get an error instead.
 func NewWordcloud(wordList map[string]int, options ...Option) *Wordcloud {
-	opts := defaultOptions
-	for _, opt := range options {
-		opt(&opts)
+	w, err := New(wordList, options...)
+	if err != nil {
+		panic(err)
 	}
+	return w
+}
 
-	sortedWordList := make([]wordCount, 0, len(wordList))
+// New initializes a wordcloud based on a map of word frequency. Words with the same count are placed in
+// alphabetical order.
+// Options are validated up front: the returned error is an *OptionError, a *FontError, a *WordError or ErrNoWords.
+func New(wordList map[string]int, options ...Option) (*Wordcloud, error) {
+	words := make([]Word, 0, len(wordList))
 	for word, count := range wordList {
-		sortedWordList = append(sortedWordList, wordCount{
-			word:  strings.Trim(word, " "),
-			count: count,
-			size:  5,
-		})
-
+		words = append(words, Word{Text: strings.Trim(word, " "), Weight: float64(count)})
 	}
-	sort.Slice(sortedWordList, func(i, j int) bool {
-		return sortedWordList[i].count > sortedWordList[j].count
+	// Ties are broken alphabetically so that the order does not depend on map iteration
+	sort.Slice(words, func(i, j int) bool {
+		return words[i].Text < words[j].Text
 	})
+	return NewWeighted(words, options...)
+}
 
-	wordCountMax := float64(sortedWordList[0].count)
+// newWordcloud creates a wordcloud from words sorted by decreasing weight
+func newWordcloud(sortedWordList []wordCount, fonts *fontSet, opts Options) *Wordcloud {
+	// Pinned words are placed first, right after the mask, so that the other words flow around them
+	sort.SliceStable(sortedWordList, func(i, j int) bool {
+		return sortedWordList[i].pinned() && !sortedWordList[j].pinned()
+	})
 
-	for idx := range sortedWordList {
-		word := &sortedWordList[idx]
-		word.size =
-			opts.SizeFunction(float64(word.count)/wordCountMax) *
-				float64(opts.FontMaxSize)
-		if word.size < float64(opts.FontMinSize) {
-			word.size = float64(opts.FontMinSize)
+	seed := time.Now().UnixNano()
+	if opts.Seed != nil {
+		seed = *opts.Seed
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	placer := opts.Placer
+	if placer == nil {
+		if opts.RandomPlacement {
+			placer = &RandomPlacer{}
+		} else {
+			placer = &CirclePlacer{}
 		}
 	}
 
-	dc := gg.NewContext(opts.Width, opts.Height)
-	dc.SetColor(opts.BackgroundColor)
-	dc.Clear()
-	dc.SetRGB(0, 0, 0)
-	grid := newSpatialHashMap(float64(opts.Width), float64(opts.Height), opts.Height/10)
+	w := &Wordcloud{
+		sortedWordList: sortedWordList,
+		fonts:          fonts,
+		rng:            rng,
+		seed:           seed,
+		placer:         placer,
+		width:          float64(opts.Width),
+		height:         float64(opts.Height),
+		opts:           opts,
+	}
+	if opts.ColorImage != nil {
+		w.imageColors = newImageColors(opts.ColorImage, opts.Width, opts.Height)
+	}
+	w.reset()
+	return w
+}
 
-	for _, b := range opts.Mask {
-		if opts.Debug {
-			dc.DrawRectangle(b.x(), b.y(), b.w(), b.h())
-			dc.Stroke()
-		}
-		grid.Add(b)
+// reset clears the canvas and the placed words, keeping only the mask
+func (w *Wordcloud) reset() {
+	opts := w.opts
+	w.dc = gg.NewContext(opts.Width, opts.Height)
+	w.dc.SetColor(opts.BackgroundColor)
+	w.dc.Clear()
+	w.dc.SetRGB(0, 0, 0)
+	gridSize := opts.Height / 10
+	if gridSize < 1 {
+		gridSize = 1
 	}
+	w.grid = newSpatialHashMap(float64(opts.Width), float64(opts.Height), gridSize)
 
-	radius := 1.0
-	maxRadius := math.Sqrt(float64(opts.Width*opts.Width + opts.Height*opts.Height))
-	circles := make(map[float64]*circle)
-	radii := make([]float64, 0)
-	for radius < maxRadius {
-		circles[radius] = newCircle(float64(opts.Width/2), float64(opts.Height/2), radius, 512)
-		radii = append(radii, radius)
-		radius = radius + 5.0
+	w.occupancy = nil
+	if opts.PixelCollision {
+		w.occupancy = newOccupancy(opts.Width, opts.Height)
 	}
 
-	rand.Seed(time.Now().UnixNano())
+	for _, b := range opts.Mask {
+		if opts.Debug {
+			w.dc.DrawRectangle(b.x(), b.y(), b.w(), b.h())
+			w.dc.Stroke()
+		}
+		w.grid.Add(b)
+		if w.occupancy != nil {
+			w.occupancy.fillBox(b)
+		}
+	}
 
-	return &Wordcloud{
-		wordList:        wordList,
-		sortedWordList:  sortedWordList,
-		grid:            grid,
-		dc:              dc,
-		randomPlacement: opts.RandomPlacement,
-		width:           float64(opts.Width),
-		height:          float64(opts.Height),
-		opts:            opts,
-		circles:         circles,
-		fonts:           make(map[float64]font.Face),
-		radii:           radii,
+	origin := image.Pt(opts.Width/2, opts.Height/2)
+	if opts.Origin != nil {
+		origin = *opts.Origin
 	}
+	w.placer.Init(Canvas{Width: opts.Width, Height: opts.Height, Origin: origin, Rand: w.rng})
+	w.placements = nil
+	w.unplaced = nil
+	w.missed = 0
+	w.fonts.clearFaces()
 }
 
-func (w *Wordcloud) getPreciseBoundingBoxes(b *Box) []*Box {
+// getPreciseBoundingBoxes returns boxes around the ink of a word drawn by draw within b. The word is drawn alone in
+// opaque black on a transparent layer, so that ink is found whatever the background and word colors.
+func (w *Wordcloud) getPreciseBoundingBoxes(b *Box, face font.Face, draw func(dc *gg.Context)) []*Box {
 	res := make([]*Box, 0)
 	step := 5
 
-	defColor := w.opts.BackgroundColor
-	for i := int(math.Floor(b.Left)); i < int(b.Right); i = i + step {
-		for j := int(b.Bottom); j < int(b.Top); j = j + step {
-			if w.dc.Image().At(i, j) != defColor {
+	left, right := math.Max(math.Floor(b.Left), 0), math.Min(b.Right, w.width)
+	bottom, top := math.Max(math.Floor(b.Bottom), 0), math.Min(b.Top, w.height)
+	if right <= left || top <= bottom {
+		return res
+	}
+	ink := gg.NewContext(int(math.Ceil(right-left)), int(math.Ceil(top-bottom)))
+	ink.Translate(-left, -bottom)
+	ink.SetFontFace(face)
+	ink.SetRGB(0, 0, 0)
+	draw(ink)
+	img := ink.Image().(*image.RGBA)
+	for i := int(left); i < int(right); i = i + step {
+		for j := int(bottom); j < int(top); j = j + step {
+			if img.RGBAAt(i-int(left), j-int(bottom)).A != 0 {
 				res = append(res, &Box{
 					float64(j+step) + 5,
 					float64(i) - 5,
@@ -128,44 +218,110 @@ func (w *Wordcloud) getPreciseBoundingBoxes(b *Box) []*Box {
 	return res
 }
 
-func (w *Wordcloud) setFont(size float64) {
-	_, ok := w.fonts[size]
+// setFont sets the face used to draw a word and returns it
+func (w *Wordcloud) setFont(chain []int, word string, size float64) font.Face {
+	face := w.fonts.face(chain, word, size)
+	w.dc.SetFontFace(face)
+	return face
+}
 
-	if !ok {
-		f, err := gg.LoadFontFace(w.opts.FontFile, size)
-		if err != nil {
-			panic(err)
-		}
-		w.fonts[size] = f
+// fontChain returns the fonts to try in order for a word according to the word font policy
+func (w *Wordcloud) fontChain(wc wordCount) []int {
+	wordFont := wc.font
+	if wordFont < 0 && w.opts.WordFontFunction != nil {
+		wordFont = w.opts.WordFontFunction(w.rng, wc.word, wc.rank)
 	}
-
-	w.dc.SetFontFace(w.fonts[size])
+	return w.fonts.chain(wordFont)
 }
 
 func (w *Wordcloud) Place(wc wordCount) bool {
-	c := w.opts.Colors[rand.Intn(len(w.opts.Colors))]
-	w.dc.SetColor(c)
+	return w.place(context.Background(), wc)
+}
 
-	w.setFont(wc.size)
+// place draws a word at the first free position. It returns false if there is no space left or ctx is done.
+func (w *Wordcloud) place(ctx context.Context, wc wordCount) bool {
+	c := w.opts.Colors[w.rng.Intn(len(w.opts.Colors))]
+	if w.opts.ColorFunction != nil {
+		if fc := w.opts.ColorFunction(w.rng, wc.word, wc.rank, wc.weight, wc.spread); fc != nil {
+			c = fc
+		}
+	}
+
+	chain := w.fontChain(wc)
+	face := w.setFont(chain, wc.word, wc.size)
 	width, height := w.dc.MeasureString(wc.word)
+	angle := w.rotation(wc)
 
 	width += 5
 	height += 5
-	x, y, space := w.nextPos(width, height)
-	if !space {
-		return false
-	}
-	w.dc.DrawStringAnchored(wc.word, x, y, 0.5, 0.5)
+	tested := newCover(height/2, -width/2, width/2, -height/2, angle)
+	// Leave some room below the text box for descenders
+	covered := newCover(height/2+0.3*height, -width/2, width/2, -height/2, angle)
 
-	box := &Box{
-		y + height/2 + 0.3*height,
-		x - width/2,
-		x + width/2,
-		math.Max(y-height/2, 0),
+	var fits FitFunc = func(x float64, y float64) bool {
+		return w.free(tested, x, y)
 	}
-	if height > 40 {
-		preciseBoxes := w.getPreciseBoundingBoxes(box)
-		for _, pb := range preciseBoxes {
+	var s *sprite
+	if w.occupancy != nil {
+		s = newSprite(face, wc.word, angle, bounds(covered.at(0, 0)), w.opts.CollisionMargin)
+		// Sprites are drawn at whole pixels so that their ink matches the canvas
+		fits = func(x float64, y float64) bool {
+			return w.occupancy.fits(s, int(math.Round(x)), int(math.Round(y)))
+		}
+	}
+	var x, y float64
+	if pos := wc.entry.Position; pos != nil {
+		x, y = float64(pos.X), float64(pos.Y)
+		if !fits(x, y) {
+			return false
+		}
+	} else {
+		b := bounds(tested.at(0, 0))
+		var space bool
+		x, y, space = w.placer.Place(ctx, Footprint{
+			Word:     wc.word,
+			Rank:     wc.rank,
+			FontSize: wc.size,
+			Rotation: angle,
+			Width:    b.w(),
+			Height:   b.h(),
+		}, fits)
+		if !space {
+			return false
+		}
+	}
+	if s != nil {
+		x, y = math.Round(x), math.Round(y)
+	}
+	if w.imageColors != nil {
+		// Words outside of the image keep their random color
+		if ic, ok := w.imageColors.at(tested.at(x, y)); ok {
+			c = ic
+		}
+	}
+	if wc.entry.Color != nil {
+		c = wc.entry.Color
+	}
+	draw := func(dc *gg.Context) {
+		if angle != 0 {
+			dc.Push()
+			dc.RotateAbout(gg.Radians(angle), x, y)
+			dc.DrawStringAnchored(wc.word, x, y, 0.5, 0.5)
+			dc.Pop()
+		} else {
+			dc.DrawStringAnchored(wc.word, x, y, 0.5, 0.5)
+		}
+	}
+	w.dc.SetColor(c)
+	draw(w.dc)
+
+	boxes := covered.at(x, y)
+	if s != nil {
+		w.occupancy.add(s, int(x), int(y))
+	} else if height > 40 {
+		b := bounds(boxes)
+		boxes = w.getPreciseBoundingBoxes(&b, face, draw)
+		for _, pb := range boxes {
 			w.grid.Add(pb)
 			if w.opts.Debug {
 				w.dc.DrawRectangle(pb.x(), pb.y(), pb.w(), pb.h())
@@ -173,223 +329,319 @@ func (w *Wordcloud) Place(wc wordCount) bool {
 			}
 		}
 	} else {
-		w.grid.Add(box)
+		for _, b := range boxes {
+			w.grid.Add(b)
+		}
 	}
+
+	w.placements = append(w.placements, placement{
+		word:     wc.word,
+		count:    wc.count,
+		weight:   wc.entry.Weight,
+		url:      wc.entry.URL,
+		meta:     wc.entry.Meta,
+		x:        x,
+		y:        y,
+		baseline: y + 0.5*w.dc.FontHeight(),
+		width:    width - 5,
+		height:   height - 5,
+		size:     wc.size,
+		family:   w.fonts.family(chain),
+		rotation: angle,
+		color:    c,
+		boxes:    boxes,
+	})
 	return true
 }
 
 // Draw tries to place words one by one, starting with the ones with the highest counts
 func (w *Wordcloud) Draw() image.Image {
-	consecutiveMisses := 0
-	for _, wc := range w.sortedWordList {
-		success := w.Place(wc)
-		if !success {
-			consecutiveMisses++
-			if consecutiveMisses > 10 {
-				return w.dc.Image()
-			}
-			continue
+	img, _ := w.DrawContext(context.Background())
+	return img
+}
+
+// DrawContext is like Draw but stops placing words as soon as ctx is done. It then returns the partial image
+// along with the context error. The words that were not placed yet are reported as unplaced by Layout.
+// Calling Draw or DrawContext again after a cancelled layout starts over from scratch.
+func (w *Wordcloud) DrawContext(ctx context.Context) (image.Image, error) {
+	if w.layoutErr != nil {
+		w.restart()
+	}
+	err := w.layout(ctx)
+	return w.dc.Image(), err
+}
+
+// restart discards a cancelled layout. The random number generator is seeded again so that the next layout is the
+// same as the one of a new wordcloud.
+func (w *Wordcloud) restart() {
+	w.rng = rand.New(rand.NewSource(w.seed))
+	w.drawn = false
+	w.layoutErr = nil
+	w.passes = 0
+	w.reset()
+}
+
+// Font sizes are multiplied by shrinkFactor each time a word is retried or a layout pass is restarted
+const shrinkFactor = 0.9
+
+// layout places the words once. Later calls reuse the existing placements.
+func (w *Wordcloud) layout(ctx context.Context) error {
+	if w.drawn {
+		return w.layoutErr
+	}
+	w.drawn = true
+	if w.opts.FillTarget > 0 {
+		w.layoutErr = w.autoFit(ctx)
+		return w.layoutErr
+	}
+	if !w.opts.ShrinkToFit {
+		w.passes, w.scale = 1, 1
+		w.layoutErr = w.layoutPass(ctx, 1, false)
+		return w.layoutErr
+	}
+
+	// Restart with smaller fonts until every word that is not pinned fits, or all of them are at FontMinSize
+	for scale := 1.0; ; scale *= shrinkFactor {
+		if w.passes > 0 {
+			w.reset()
+		}
+		w.passes++
+		w.scale = scale
+		last := w.maxSize(scale) <= float64(w.opts.FontMinSize)
+		err := w.layoutPass(ctx, scale, !last)
+		if err != nil || last || w.missed == 0 {
+			w.layoutErr = err
+			return err
 		}
-		consecutiveMisses = 0
 	}
-	return w.dc.Image()
 }
 
-func (w *Wordcloud) nextRandom(width float64, height float64) (x float64, y float64, space bool) {
-	tries := 0
-	searching := true
-	var box Box
-	for searching && tries < 5000000 {
-		tries++
-		x, y = float64(rand.Intn(w.dc.Width())), float64(rand.Intn(w.dc.Height()))
-		// Is that position available?
-		box.Top = y + height/2
-		box.Left = x - width/2
-		box.Right = x + width/2
-		box.Bottom = y - height/2
+// Max number of trial layouts when auto-fitting, and the precision of the scale
+const (
+	autoFitTrials    = 10
+	autoFitPrecision = 1.05
+)
 
-		if !box.fits(w.width, w.height) {
+// autoFit searches the largest font scale that places every word, stopping as soon as a layout that places every
+// word covers FillTarget of the canvas. Pinned words that do not fit are ignored, since scaling does not move them. The scale starts at 1, and doubles while every word fits without reaching
+// FillTarget. Every trial is a complete layout, the best one is kept.
+func (w *Wordcloud) autoFit(ctx context.Context) error {
+	// lo places every word without reaching FillTarget, hi does not place every word
+	lo, hi := 1.0, 0.0
+	placed, err := w.trial(ctx, lo)
+	if err != nil || (placed && w.fill() >= w.opts.FillTarget) {
+		return err
+	}
+	if !placed {
+		hi, lo = lo, float64(w.opts.FontMinSize)/float64(w.opts.FontMaxSize)
+		placed, err = w.trial(ctx, lo)
+		if err != nil || !placed || w.fill() >= w.opts.FillTarget {
+			// Words do not fit even at the smallest scale
+			return err
+		}
+	}
+	best := w.save()
+	for i := w.passes; i < autoFitTrials && (hi == 0 || hi/lo > autoFitPrecision); i++ {
+		// Grow the scale until words do not fit anymore, then bisect
+		mid := 2 * lo
+		if hi > 0 {
+			mid = math.Sqrt(lo * hi)
+		}
+		placed, err = w.trial(ctx, mid)
+		if err != nil {
+			return err
+		}
+		if !placed {
+			hi = mid
 			continue
 		}
-		colliding, _ := w.grid.TestCollision(&box, func(a *Box, b *Box) bool {
-			return a.overlaps(b)
-		})
-
-		if !colliding {
-			space = true
-			searching = false
-			return
+		lo = mid
+		best = w.save()
+		if w.fill() >= w.opts.FillTarget {
+			break
 		}
 	}
-	return
-}
-
-// Data sent to placement workers
-type workerData struct {
-	radius    float64
-	positions []point
-	width     float64
-	height    float64
-}
-
-// Results sent from placement workers
-type res struct {
-	radius float64
-	x      float64
-	y      float64
-	failed bool
-}
-
-// Multithreaded word placement
-func (w *Wordcloud) nextPos(width float64, height float64) (x float64, y float64, space bool) {
-	if w.randomPlacement {
-		return w.nextRandom(width, height)
-	}
-
-	space = false
-
-	x, y = w.width, w.height
-
-	stopSendingCh := make(chan struct{}, 1)
-	aggCh := make(chan res, 100)
-	workCh := make(chan workerData, runtime.NumCPU())
-	results := make(map[float64]res)
-	done := make(map[float64]bool)
-	stopChannels := make([]chan struct{}, 0)
-	wg := sync.WaitGroup{}
-
-	// Start workers that will test each one "circle" of positions
-	for i := 0; i < runtime.NumCPU(); i++ {
-		wg.Add(1)
-		stopCh := make(chan struct{}, 1)
-		go func(ch chan struct{}, i int) {
-			defer wg.Done()
-			for {
-				select {
-				// Receive data
-				case d, ok := <-workCh:
-					if !ok {
-						return
-					}
-					// Test the positions and post results on aggCh
-					aggCh <- w.testRadius(d.radius, d.positions, d.width, d.height)
-				case <-ch:
-					// Stop signal
-					return
-				}
-			}
-		}(stopCh, i)
-		stopChannels = append(stopChannels, stopCh)
-	}
-
-	// Post positions to test to worker channel
-	go func() {
-		for _, r := range w.radii {
-			c := w.circles[r]
-			select {
-			case <-stopSendingCh:
-				// Stop sending data immediately if a position has already been found
-				close(workCh)
-				return
-			case workCh <- workerData{
-				radius:    r,
-				positions: c.positions(),
-				width:     width,
-				height:    height,
-			}:
-			}
+	w.restore(best)
+	return nil
+}
+
+// trial lays the words out from scratch with their font sizes multiplied by scale and reports whether every word
+// was placed. Pinned words are left out, scaling does not move them.
+func (w *Wordcloud) trial(ctx context.Context, scale float64) (bool, error) {
+	if w.passes > 0 {
+		w.reset()
+	}
+	w.passes++
+	w.scale = scale
+	err := w.layoutPass(ctx, scale, false)
+	return w.missed == 0, err
+}
+
+// layoutState is the result of a trial layout
+type layoutState struct {
+	dc         *gg.Context
+	grid       *spatialHashMap
+	occupancy  *occupancy
+	placements []placement
+	unplaced   []string
+	missed     int
+	scale      float64
+}
+
+func (w *Wordcloud) save() layoutState {
+	return layoutState{
+		dc:         w.dc,
+		grid:       w.grid,
+		occupancy:  w.occupancy,
+		placements: w.placements,
+		unplaced:   w.unplaced,
+		missed:     w.missed,
+		scale:      w.scale,
+	}
+}
+
+func (w *Wordcloud) restore(s layoutState) {
+	w.dc = s.dc
+	w.grid = s.grid
+	w.occupancy = s.occupancy
+	w.placements = s.placements
+	w.unplaced = s.unplaced
+	w.missed = s.missed
+	w.scale = s.scale
+}
+
+// fill returns the ratio of the canvas outside of the mask covered by the text boxes of the placed words
+func (w *Wordcloud) fill() float64 {
+	free := w.width * w.height
+	for _, b := range w.opts.Mask {
+		free -= b.w() * b.h()
+	}
+	if free <= 0 {
+		return 1
+	}
+	covered := 0.0
+	for _, p := range w.placements {
+		covered += p.width * p.height
+	}
+	return math.Min(covered/free, 1)
+}
+
+// layoutPass places the words with their font sizes multiplied by scale, clamped to FontMinSize.
+// Pinned words come first and never stop the pass. Without ShrinkToFit, the pass gives up after 10 consecutive
+// words that do not fit. With ShrinkToFit, words that do not fit are retried at smaller sizes, and with strict the
+// pass stops at the first word that does not fit even at FontMinSize.
+func (w *Wordcloud) layoutPass(ctx context.Context, scale float64, strict bool) error {
+	consecutiveMisses := 0
+	for i, wc := range w.sortedWordList {
+		if !wc.fixed() {
+			wc.size = w.scaledSize(wc.size, scale)
+		}
+		if ctx.Err() == nil && w.placeShrinking(ctx, wc) {
+			consecutiveMisses = 0
+			w.progress(wc)
+			continue
 		}
-		// Close channel after all positions have been sent
-		close(workCh)
-	}()
-
-	defer func() {
-		// Stop data sending
-		stopSendingCh <- struct{}{}
-		// Tell the worker goroutines to stop
-		for _, c := range stopChannels {
-			c <- struct{}{}
+		if err := ctx.Err(); err != nil {
+			w.skip(w.sortedWordList[i:])
+			return err
 		}
-		// Purge res channel in case some workers are still sending data
-		go func() {
-			for {
-				select {
-				case <-aggCh:
-				default:
-					return
-				}
-			}
-		}()
-
-		// Wait for all goroutines to stop. We want to wait for them so that no thread is accessing internal data structs
-		// such as the spatial hashmap
-		wg.Wait()
-	}()
-
-	// Finally, aggregate the results coming from workers
-	for d := range aggCh {
-		results[d.radius] = d
-		done[d.radius] = true
-		//check if we need to continue
-		failed := true
-		// Example: if we know that there's a successful placement at r=10 but have not received results for r=5,
-		// we need to wait as there might be a closer successful position
-		for _, r := range w.radii {
-			if !done[r] {
-				// Some positions are not done. They might be successful
-				failed = false
-				break
-			}
-			// We have the successful placement with the lowest radius
-			if !results[r].failed {
-				return results[r].x, results[r].y, true
-			}
+		w.unplaced = append(w.unplaced, wc.word)
+		w.progress(wc)
+		if wc.pinned() {
+			// Other words may still fit around a pinned word that does not
+			continue
 		}
+		w.missed++
+		if strict {
+			w.skip(w.sortedWordList[i+1:])
+			return nil
+		}
+		consecutiveMisses++
+		if !w.opts.ShrinkToFit && consecutiveMisses > 10 {
+			// Give up on the remaining words
+			w.skip(w.sortedWordList[i+1:])
+			return nil
+		}
+	}
+	return nil
+}
 
-		// We tried it all but could not place the word
-		if failed {
-			return
+// placeShrinking places a word, retrying at smaller sizes down to FontMinSize with ShrinkToFit
+func (w *Wordcloud) placeShrinking(ctx context.Context, wc wordCount) bool {
+	for {
+		if w.place(ctx, wc) {
+			return true
+		}
+		if !w.opts.ShrinkToFit || wc.fixed() || wc.size <= float64(w.opts.FontMinSize) || ctx.Err() != nil {
+			return false
+		}
+		wc.size = w.scaledSize(wc.size, shrinkFactor)
+	}
+}
+
+// scaledSize multiplies a font size by scale, without going below FontMinSize
+func (w *Wordcloud) scaledSize(size float64, scale float64) float64 {
+	return math.Max(size*scale, float64(w.opts.FontMinSize))
+}
+
+// maxSize returns the largest font size at the given scale, ignoring fixed sizes
+func (w *Wordcloud) maxSize(scale float64) float64 {
+	size := 0.0
+	for _, wc := range w.sortedWordList {
+		if wc.fixed() {
+			continue
 		}
+		size = math.Max(size, w.scaledSize(wc.size, scale))
+	}
+	return size
+}
 
+// skip marks words as unplaced
+func (w *Wordcloud) skip(words []wordCount) {
+	for _, wc := range words {
+		w.unplaced = append(w.unplaced, wc.word)
+		if !wc.pinned() {
+			w.missed++
+		}
 	}
-	return
 }
 
-// test a series of points on a circle and returns as soon as there's a match
-func (w *Wordcloud) testRadius(radius float64, points []point, width float64, height float64) res {
-	var box Box
-	var x, y float64
+// progress reports the number of placed words after wc was processed
+func (w *Wordcloud) progress(wc wordCount) {
+	if w.opts.Progress != nil {
+		w.opts.Progress(w.passes, len(w.placements), len(w.sortedWordList), wc.size)
+	}
+}
 
-	for _, p := range points {
-		y = p.y
-		x = p.x
+// rotation returns the angle in degrees of a word according to the rotation policy
+func (w *Wordcloud) rotation(wc wordCount) float64 {
+	if wc.entry.Rotation != nil {
+		return *wc.entry.Rotation
+	}
+	if w.opts.Rotation == nil {
+		return 0
+	}
+	return w.opts.Rotation(w.rng, wc.word, wc.rank)
+}
 
-		// Is that position available?
-		box.Top = y + height/2
-		box.Left = x - width/2
-		box.Right = x + width/2
-		box.Bottom = y - height/2
+// free reports whether a cover anchored at x, y fits in the canvas without colliding with placed boxes
+func (w *Wordcloud) free(c cover, x float64, y float64) bool {
+	var box Box
+	for _, b := range c {
+		box.Top = y + b.Top
+		box.Left = x + b.Left
+		box.Right = x + b.Right
+		box.Bottom = y + b.Bottom
 
 		if !box.fits(w.width, w.height) {
-			continue
+			return false
 		}
 		colliding, _ := w.grid.TestCollision(&box, func(a *Box, b *Box) bool {
 			return a.overlaps(b)
 		})
-
-		if !colliding {
-			return res{
-				x:      x,
-				y:      y,
-				failed: false,
-				radius: radius,
-			}
+		if colliding {
+			return false
 		}
 	}
-	return res{
-		x:      x,
-		y:      y,
-		failed: true,
-		radius: radius,
-	}
+	return true
 }
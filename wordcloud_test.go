@@ -1,13 +1,26 @@
 package wordclouds
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
 	"image/color"
+	"image/draw"
+	"image/jpeg"
 	"image/png"
+	"math"
 	"os"
+	"sort"
+	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
 	"gopkg.in/yaml.v2"
 )
 
@@ -76,3 +89,1074 @@ func TestWordcloud_Draw(t *testing.T) {
 	// Don't forget to close files
 	outputFile.Close()
 }
+
+func loadTestWords(t testing.TB) map[string]int {
+	content, err := os.ReadFile("testdata/input.yaml")
+	assert.NoError(t, err)
+	inputWords := make(map[string]int, 0)
+	err = yaml.Unmarshal(content, &inputWords)
+	assert.NoError(t, err)
+	return inputWords
+}
+
+func TestWordcloud_DrawSVG(t *testing.T) {
+	w := NewWordcloud(loadTestWords(t),
+		FontFile("testdata/Roboto-Regular.ttf"),
+		FontMaxSize(100),
+		FontMinSize(10),
+		Height(512),
+		Width(512),
+	)
+
+	var buf bytes.Buffer
+	err := w.DrawSVG(&buf)
+	assert.NoError(t, err)
+
+	svg := buf.String()
+	assert.True(t, strings.HasPrefix(svg, "<svg "))
+	assert.Contains(t, svg, "font-family=\"&#39;Roboto&#39;, sans-serif\"")
+	assert.Equal(t, len(w.placements), strings.Count(svg, "<text "))
+	assert.NotZero(t, len(w.placements))
+}
+
+func TestWordcloud_Layout(t *testing.T) {
+	words := loadTestWords(t)
+	w := NewWordcloud(words,
+		FontFile("testdata/Roboto-Regular.ttf"),
+		FontMaxSize(100),
+		FontMinSize(10),
+		Colors([]color.Color{color.RGBA{R: 0x59, G: 0x3a, B: 0xee, A: 0xff}}),
+		Height(512),
+		Width(512),
+	)
+
+	l := w.Layout()
+	assert.Equal(t, len(words), len(l.Words)+len(l.Unplaced))
+	assert.Equal(t, "#593aee", l.Words[0].Color)
+	for _, pw := range l.Words {
+		assert.NotEmpty(t, pw.Boxes)
+	}
+
+	b, err := json.Marshal(l)
+	assert.NoError(t, err)
+	var decoded Layout
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, l, decoded)
+}
+
+func TestNew_Errors(t *testing.T) {
+	words := map[string]int{"important": 42, "noteworthy": 30, "meh": 3}
+	font := FontFile("testdata/Roboto-Regular.ttf")
+
+	_, err := New(map[string]int{}, font)
+	assert.True(t, errors.Is(err, ErrNoWords))
+
+	_, err = New(words, FontFile("testdata/missing.ttf"))
+	var fontErr *FontError
+	assert.True(t, errors.As(err, &fontErr))
+	assert.Equal(t, "testdata/missing.ttf", fontErr.Path)
+
+	invalid := map[string][]Option{
+		"Width":           {font, Width(0)},
+		"Height":          {font, Height(-1)},
+		"Colors":          {font, Colors(nil)},
+		"FontMaxSize":     {font, FontMinSize(50), FontMaxSize(20)},
+		"FontMinSize":     {font, FontMinSize(0)},
+		"SizeFunction":    {font, WordSizeFunction("cubic")},
+		"BackgroundColor": {font, BackgroundColor(nil)},
+		"Origin":          {font, Width(100), Origin(100, 50)},
+	}
+	for option, opts := range invalid {
+		_, err := New(words, opts...)
+		var optErr *OptionError
+		if assert.True(t, errors.As(err, &optErr), option) {
+			assert.Equal(t, option, optErr.Option)
+		}
+	}
+
+	_, err = MaskFromImage(image.NewRGBA(image.Rect(0, 0, 0, 0)), 100, 100, color.RGBA{})
+	var maskErr *MaskError
+	assert.True(t, errors.As(err, &maskErr))
+
+	_, err = LoadMask("testdata/missing.png", 100, 100, color.RGBA{})
+	assert.True(t, errors.As(err, &maskErr))
+}
+
+func TestCover_Rotation(t *testing.T) {
+	c := newCover(10, -40, 40, -10, 90)
+	assert.Len(t, c, 1)
+	assert.InDelta(t, 40, c[0].Top, 1e-9)
+	assert.InDelta(t, -10, c[0].Left, 1e-9)
+	assert.InDelta(t, 10, c[0].Right, 1e-9)
+	assert.InDelta(t, -40, c[0].Bottom, 1e-9)
+
+	// Diagonal words are sliced so that the cover stays close to the glyphs
+	c = newCover(10, -40, 40, -10, 45)
+	assert.Len(t, c, 4)
+	area := 0.0
+	for _, b := range c {
+		area += b.w() * b.h()
+	}
+	outer := bounds(c.at(0, 0))
+	assert.Less(t, area, outer.w()*outer.h()*0.7)
+}
+
+func TestWordcloud_Rotation(t *testing.T) {
+	w := NewWordcloud(loadTestWords(t),
+		FontFile("testdata/Roboto-Regular.ttf"),
+		FontMaxSize(100),
+		FontMinSize(10),
+		Colors([]color.Color{color.Black}),
+		RotationFunction(func(word string, rank int) float64 {
+			if rank%2 == 1 {
+				return 90
+			}
+			return 0
+		}),
+		Height(512),
+		Width(512),
+	)
+
+	l := w.Layout()
+	for _, pw := range l.Words {
+		if pw.Rotation == 90 {
+			// Vertical words are taller than wide
+			b := bounds(pw.Boxes)
+			assert.Greater(t, b.h(), b.w()*0.8, pw.Word)
+		}
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, w.DrawSVG(&buf))
+	assert.Contains(t, buf.String(), "transform=\"rotate(90 ")
+}
+
+func TestWordcloud_Seed(t *testing.T) {
+	// Keep few words so that random placement does not exhaust its tries
+	words := make(map[string]int)
+	for word, count := range loadTestWords(t) {
+		if count > 5 {
+			words[word] = count
+		}
+	}
+	render := func(placement bool) ([]byte, Layout) {
+		w := NewWordcloud(words,
+			FontFile("testdata/Roboto-Regular.ttf"),
+			FontMaxSize(100),
+			FontMinSize(10),
+			Colors([]color.Color{color.Black, color.RGBA{R: 0x59, G: 0x3a, B: 0xee, A: 0xff}}),
+			Rotations(0, -90),
+			RandomPlacement(placement),
+			Seed(42),
+			Height(512),
+			Width(512),
+		)
+		var buf bytes.Buffer
+		assert.NoError(t, png.Encode(&buf, w.Draw()))
+		return buf.Bytes(), w.Layout()
+	}
+
+	for _, random := range []bool{false, true} {
+		img1, layout1 := render(random)
+		img2, layout2 := render(random)
+		assert.Equal(t, layout1, layout2)
+		assert.True(t, bytes.Equal(img1, img2), "images differ")
+	}
+}
+
+func TestWordcloud_DrawContext(t *testing.T) {
+	words := loadTestWords(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	retried := false
+	options := []Option{
+		FontFile("testdata/Roboto-Regular.ttf"),
+		FontMaxSize(100),
+		FontMinSize(10),
+		Height(512),
+		Width(512),
+		Seed(1),
+	}
+	w := NewWordcloud(words, append(options, Progress(func(pass int, placed int, total int, fontSize float64) {
+		calls++
+		assert.Equal(t, 1, pass)
+		assert.Equal(t, len(words), total)
+		if !retried {
+			assert.Equal(t, calls, placed)
+		}
+		if placed == 5 {
+			cancel()
+		}
+	}))...)
+
+	img, err := w.DrawContext(ctx)
+	assert.NotNil(t, img)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, 5, calls)
+
+	l := w.Layout()
+	assert.Len(t, l.Words, 5)
+	assert.Len(t, l.Unplaced, len(words)-5)
+
+	// Drawing again starts over, like a new wordcloud
+	retried = true
+	_, err = w.DrawContext(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, NewWordcloud(words, options...).Layout(), w.Layout())
+
+	// So does the SVG output
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	w = NewWordcloud(words, append(options, Progress(func(_ int, placed int, _ int, _ float64) {
+		if placed == 5 {
+			cancel()
+		}
+	}))...)
+	_, err = w.DrawContext(ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+	var got, want bytes.Buffer
+	assert.NoError(t, w.DrawSVG(&got))
+	assert.NoError(t, NewWordcloud(words, options...).DrawSVG(&want))
+	assert.Equal(t, want.String(), got.String())
+}
+
+func TestWordcloud_FontFallback(t *testing.T) {
+	roboto := "testdata/Roboto-Regular.ttf"
+	sourceSans := "testdata/SourceSans3-Regular.ttf"
+	// Roboto has no glyph for Ǎ, Source Sans has one
+	words := map[string]int{"ǍǏ": 10, "aǍ": 8, "roboto": 5}
+
+	w := NewWordcloud(words,
+		FontFiles(roboto, sourceSans),
+		FontMaxSize(100),
+		Colors([]color.Color{color.Black}),
+		Height(512),
+		Width(512),
+	)
+	chain := w.fonts.chain(-1)
+	assert.Equal(t, []int{0, 1}, chain)
+	assert.NotEqual(t, w.fonts.sizedFace(0, 20), w.fonts.face(chain, "ǍǏ", 20))
+	assert.Equal(t, w.fonts.sizedFace(1, 20), w.fonts.face(chain, "ǍǏ", 20))
+	assert.Equal(t, w.fonts.sizedFace(0, 20), w.fonts.face(chain, "roboto", 20))
+	mixed, ok := w.fonts.face(chain, "aǍ", 20).(*fallbackFace)
+	if assert.True(t, ok) {
+		assert.Equal(t, w.fonts.sizedFace(1, 20), mixed.pick('Ǎ'))
+		assert.Equal(t, w.fonts.sizedFace(0, 20), mixed.pick('a'))
+	}
+
+	l := w.Layout()
+	assert.Len(t, l.Words, 3)
+	assert.Equal(t, "'Roboto', 'Source Sans 3', sans-serif", l.Words[0].FontFamily)
+
+	// FontFile comes first whatever the order of the options
+	for _, opts := range [][]Option{
+		{FontFile(roboto), Fonts(FontPath(sourceSans))},
+		{Fonts(FontPath(sourceSans)), FontFile(roboto)},
+	} {
+		w = NewWordcloud(words, opts...)
+		assert.Equal(t, "'Roboto', 'Source Sans 3', sans-serif", w.fonts.family(w.fonts.chain(-1)))
+	}
+
+	// The top word uses its own font, with the fallback chain behind it
+	w = NewWordcloud(words,
+		FontFile(roboto),
+		WordFontFunction([]FontSource{FontPath(sourceSans)}, func(word string, rank int) int {
+			if rank == 0 {
+				return 0
+			}
+			return -1
+		}),
+		FontMaxSize(100),
+		Height(512),
+		Width(512),
+	)
+	l = w.Layout()
+	assert.Equal(t, "'Source Sans 3', 'Roboto', sans-serif", l.Words[0].FontFamily)
+	assert.Equal(t, "'Roboto', sans-serif", l.Words[1].FontFamily)
+}
+
+func TestWordcloud_FontSources(t *testing.T) {
+	words := map[string]int{"important": 42, "noteworthy": 30, "meh": 3}
+
+	// Zero configuration uses the embedded font
+	w, err := New(words)
+	assert.NoError(t, err)
+	l := w.Layout()
+	assert.NotEmpty(t, l.Words)
+	assert.Equal(t, "'Go', sans-serif", l.Words[0].FontFamily)
+
+	robotoBytes, err := os.ReadFile("testdata/Roboto-Regular.ttf")
+	assert.NoError(t, err)
+	otf, err := opentype.Parse(goregular.TTF)
+	assert.NoError(t, err)
+
+	sources := map[string]FontSource{
+		"'Roboto', sans-serif":       FontFS(os.DirFS("testdata"), "Roboto-Regular.ttf"),
+		"'Roboto', 'Go', sans-serif": FontBytes(robotoBytes),
+		"'Go', sans-serif":           OpenTypeFont(otf),
+	}
+	for family, src := range sources {
+		opts := []Option{Fonts(src), FontMaxSize(100), Width(512), Height(512)}
+		if src.data != nil {
+			opts[0] = Fonts(src, DefaultFont)
+		}
+		w, err := New(words, opts...)
+		if assert.NoError(t, err, family) {
+			l := w.Layout()
+			assert.Len(t, l.Words, 3, family)
+			assert.Equal(t, family, l.Words[0].FontFamily)
+		}
+	}
+
+	// The same path in two file systems is two fonts
+	robotoFS := fstest.MapFS{"font.ttf": {Data: robotoBytes}}
+	sourceSansBytes, err := os.ReadFile("testdata/SourceSans3-Regular.ttf")
+	assert.NoError(t, err)
+	sourceSansFS := fstest.MapFS{"font.ttf": {Data: sourceSansBytes}}
+	w, err = New(words, Fonts(FontFS(robotoFS, "font.ttf"), FontFS(sourceSansFS, "font.ttf")))
+	if assert.NoError(t, err) {
+		assert.Len(t, w.fonts.fonts, 2)
+		assert.Equal(t, "'Roboto', 'Source Sans 3', sans-serif", w.fonts.family(w.fonts.chain(-1)))
+	}
+
+	_, err = New(words, Fonts(FontFS(os.DirFS("testdata"), "missing.ttf")))
+	var fontErr *FontError
+	assert.True(t, errors.As(err, &fontErr))
+	assert.Equal(t, "fs:missing.ttf", fontErr.Path)
+
+	_, err = New(words, Fonts(FontBytes([]byte("not a font"))))
+	assert.True(t, errors.As(err, &fontErr))
+}
+
+func TestWordcloud_PixelCollision(t *testing.T) {
+	w := NewWordcloud(loadTestWords(t),
+		FontFile("testdata/Roboto-Regular.ttf"),
+		FontMaxSize(150),
+		FontMinSize(10),
+		Rotations(0, -90, 30),
+		PixelCollision(0),
+		Seed(3),
+		Height(512),
+		Width(512),
+	)
+	l := w.Layout()
+	assert.NotEmpty(t, l.Words)
+
+	// Replaying the placed words on an empty bitmap never overlaps
+	occ := newOccupancy(512, 512)
+	for _, p := range w.placements {
+		face := w.fonts.face(w.fonts.chain(-1), p.word, p.size)
+		b := Box{Top: p.height, Left: -p.width / 2, Right: p.width / 2, Bottom: -p.height}
+		s := newSprite(face, p.word, p.rotation, b, 0)
+		x, y := int(p.x), int(p.y)
+		assert.True(t, occ.fits(s, x, y), p.word)
+		occ.add(s, x, y)
+	}
+}
+
+func TestOccupancy(t *testing.T) {
+	occ := newOccupancy(200, 100)
+	occ.fillBox(&Box{Top: 60, Left: 70, Right: 130, Bottom: 40})
+
+	s := &sprite{width: 10, height: 10, stride: 1, bits: make([]uint64, 10), ax: 5, ay: 5}
+	for i := range s.bits {
+		s.bits[i] = 1<<10 - 1
+	}
+	assert.False(t, occ.fits(s, 100, 50))
+	assert.False(t, occ.fits(s, 66, 50))
+	assert.True(t, occ.fits(s, 64, 50))
+	assert.True(t, occ.fits(s, 100, 34))
+	assert.False(t, occ.fits(s, 100, 36))
+	// Out of the canvas
+	assert.False(t, occ.fits(s, 196, 50))
+
+	occ.add(s, 150, 20)
+	assert.False(t, occ.fits(s, 159, 29))
+	assert.True(t, occ.fits(s, 160, 20))
+}
+
+// flowPlacer places words from left to right, top to bottom, on a 10px grid
+type flowPlacer struct {
+	canvas Canvas
+	words  []string
+}
+
+func (p *flowPlacer) Init(c Canvas) {
+	p.canvas = c
+}
+
+func (p *flowPlacer) Place(ctx context.Context, fp Footprint, fits FitFunc) (float64, float64, bool) {
+	p.words = append(p.words, fp.Word)
+	for y := 0; y < p.canvas.Height; y += 10 {
+		for x := 0; x < p.canvas.Width; x += 10 {
+			if fits(float64(x)+fp.Width/2, float64(y)+fp.Height/2) {
+				return float64(x) + fp.Width/2, float64(y) + fp.Height/2, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+func TestWordcloud_Placer(t *testing.T) {
+	placer := &flowPlacer{}
+	w := NewWordcloud(map[string]int{"important": 42, "noteworthy": 30, "meh": 3},
+		FontFile("testdata/Roboto-Regular.ttf"),
+		FontMaxSize(40),
+		Placement(placer),
+		Height(512),
+		Width(512),
+	)
+	l := w.Layout()
+
+	assert.Equal(t, 512, placer.canvas.Width)
+	assert.Equal(t, []string{"important", "noteworthy", "meh"}, placer.words)
+	assert.Len(t, l.Words, 3)
+	// The top word is in the top left corner
+	assert.Less(t, l.Words[0].X, 150.0)
+	assert.Less(t, l.Words[0].Y, 50.0)
+}
+
+func TestSpirals(t *testing.T) {
+	rect := rectangularSpiral(1500, 400, 3000, 800, 4)
+	arch := archimedeanSpiral(1500, 400, 3000, 800, 5)
+	for name, pts := range map[string][]point{"rectangular": rect, "archimedean": arch} {
+		assert.Equal(t, point{x: 1500, y: 400}, pts[0], name)
+		covered := Box{Left: 1500, Right: 1500, Bottom: 400, Top: 400}
+		for _, p := range pts {
+			assert.True(t, inCanvas(p, 3000, 800), name)
+			covered.Left, covered.Right = math.Min(covered.Left, p.x), math.Max(covered.Right, p.x)
+			covered.Bottom, covered.Top = math.Min(covered.Bottom, p.y), math.Max(covered.Top, p.y)
+		}
+		// The spiral reaches the corners of the canvas
+		assert.Less(t, covered.Left, 20.0, name)
+		assert.Greater(t, covered.Right, 2980.0, name)
+		assert.Less(t, covered.Bottom, 20.0, name)
+		assert.Greater(t, covered.Top, 780.0, name)
+	}
+
+	chunks := chunk(rect, spiralChunk)
+	assert.Len(t, chunks[0], spiralChunk)
+	assert.Equal(t, rect[spiralChunk], chunks[1][0])
+}
+
+func TestWordcloud_SpiralPlacers(t *testing.T) {
+	inputWords := loadTestWords(t)
+	for _, p := range []Placer{&ArchimedeanPlacer{}, &RectangularPlacer{}} {
+		w, err := New(inputWords,
+			FontFile("testdata/Roboto-Regular.ttf"),
+			FontMaxSize(150),
+			Placement(p),
+			Width(1500),
+			Height(400),
+			Seed(1),
+		)
+		assert.NoError(t, err)
+		l := w.Layout()
+		assert.NotEmpty(t, l.Words)
+		// The top word is in the middle
+		assert.InDelta(t, 750, l.Words[0].X, 10)
+		assert.InDelta(t, 200, l.Words[0].Y, 10)
+	}
+}
+
+func TestWordcloud_Origin(t *testing.T) {
+	inputWords := loadTestWords(t)
+	for _, p := range []Placer{&CirclePlacer{}, &ArchimedeanPlacer{}, &RectangularPlacer{}} {
+		w, err := New(inputWords,
+			FontFile("testdata/Roboto-Regular.ttf"),
+			FontMaxSize(100),
+			Placement(p),
+			Width(1600),
+			Height(400),
+			Origin(1200, 150),
+			Seed(1),
+		)
+		assert.NoError(t, err)
+		l := w.Layout()
+		// The top word is at the origin
+		assert.InDelta(t, 1200, l.Words[0].X, 10)
+		assert.InDelta(t, 150, l.Words[0].Y, 10)
+	}
+}
+
+func TestCirclePlacer_Aspect(t *testing.T) {
+	p := &CirclePlacer{}
+	p.Init(Canvas{Width: 4000, Height: 1000, Origin: image.Pt(2000, 500)})
+	// The second ring is an ellipse 4 times wider than high
+	minX, maxX, minY, maxY := math.Inf(1), math.Inf(-1), math.Inf(1), math.Inf(-1)
+	for _, pt := range p.rings[1] {
+		minX, maxX = math.Min(minX, pt.x), math.Max(maxX, pt.x)
+		minY, maxY = math.Min(minY, pt.y), math.Max(maxY, pt.y)
+	}
+	assert.InDelta(t, 4, (maxX-minX)/(maxY-minY), 1e-6)
+	// The last ring reaches the corners
+	last := p.rings[len(p.rings)-1]
+	assert.NotEmpty(t, last)
+	for _, pt := range last {
+		assert.True(t, pt.x < 100 || pt.x > 3900)
+	}
+}
+
+func TestWordcloud_ShrinkToFit(t *testing.T) {
+	inputWords := loadTestWords(t)
+	opts := []Option{
+		FontFile("testdata/Roboto-Regular.ttf"),
+		FontMaxSize(120),
+		FontMinSize(6),
+		Width(400),
+		Height(400),
+		Seed(1),
+	}
+	l := NewWordcloud(inputWords, opts...).Layout()
+	assert.NotEmpty(t, l.Unplaced)
+	assert.Equal(t, 1, l.Passes)
+
+	// Progress is reported per pass
+	lastPass, lastPlaced := 1, 0
+	w := NewWordcloud(inputWords, append(opts, ShrinkToFit(), Progress(func(pass int, placed int, _ int, _ float64) {
+		if pass != lastPass {
+			assert.Equal(t, lastPass+1, pass)
+			lastPass, lastPlaced = pass, 0
+		}
+		assert.GreaterOrEqual(t, placed, lastPlaced)
+		lastPlaced = placed
+	}))...)
+	l = w.Layout()
+	// Faces of the previous passes and retried sizes are not kept
+	assert.LessOrEqual(t, len(w.fonts.faces), maxFaces)
+	assert.Empty(t, l.Unplaced)
+	assert.Len(t, l.Words, len(inputWords))
+	assert.Greater(t, l.Passes, 1)
+	assert.Equal(t, l.Passes, lastPass)
+	assert.Less(t, l.Scale, 1.0)
+	assert.LessOrEqual(t, l.Words[0].FontSize, 120*l.Scale)
+}
+
+func TestWordcloud_AutoFit(t *testing.T) {
+	inputWords := loadTestWords(t)
+	opts := []Option{
+		FontFile("testdata/Roboto-Regular.ttf"),
+		FontMaxSize(400),
+		FontMinSize(5),
+		Width(600),
+		Height(600),
+		Seed(1),
+	}
+	full := NewWordcloud(inputWords, append(opts, AutoFit(1))...).Layout()
+	assert.Empty(t, full.Unplaced)
+	assert.Less(t, full.Scale, 1.0)
+	assert.LessOrEqual(t, full.Passes, autoFitTrials)
+
+	// A lower target stops the search earlier, with smaller fonts
+	sparse := NewWordcloud(inputWords, append(opts, AutoFit(0.05))...).Layout()
+	assert.Empty(t, sparse.Unplaced)
+	assert.GreaterOrEqual(t, sparse.Fill, 0.05)
+	assert.Less(t, sparse.Scale, full.Scale)
+	assert.Less(t, sparse.Fill, full.Fill)
+
+	// Fonts that are too small grow above FontMaxSize
+	small := NewWordcloud(inputWords, FontFile("testdata/Roboto-Regular.ttf"), FontMaxSize(20), FontMinSize(5),
+		Width(1024), Height(1024), Seed(1), AutoFit(0.5)).Layout()
+	assert.Empty(t, small.Unplaced)
+	assert.Greater(t, small.Scale, 1.0)
+	assert.Greater(t, small.Words[0].FontSize, 20.0)
+	assert.InDelta(t, 0.5, small.Fill, 0.1)
+
+	_, err := New(inputWords, AutoFit(1.5))
+	var optErr *OptionError
+	assert.True(t, errors.As(err, &optErr))
+}
+
+func TestMaskRules(t *testing.T) {
+	// A black disk on a noisy white background, saved as a JPEG
+	img := image.NewRGBA(image.Rect(0, 0, 90, 90))
+	for x := 0; x < 90; x++ {
+		for y := 0; y < 90; y++ {
+			if math.Hypot(float64(x-45), float64(y-45)) < 30 {
+				img.Set(x, y, color.Black)
+			} else {
+				noise := uint8((x*7 + y*13) % 20)
+				img.Set(x, y, color.RGBA{R: 255 - noise, G: 255 - noise, B: 255 - noise, A: 255})
+			}
+		}
+	}
+	path := t.TempDir() + "/mask.jpg"
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	assert.NoError(t, jpeg.Encode(f, img, &jpeg.Options{Quality: 60}))
+	assert.NoError(t, f.Close())
+
+	// The center and the corners of the canvas
+	center := &Box{Top: 46, Left: 44, Right: 46, Bottom: 44}
+	corner := &Box{Top: 2, Left: 0, Right: 2, Bottom: 0}
+	covers := func(boxes []*Box, b *Box) bool {
+		for _, m := range boxes {
+			if m.overlaps(b) {
+				return true
+			}
+		}
+		return false
+	}
+
+	exact, err := LoadMask(path, 90, 90, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	assert.NoError(t, err)
+	assert.False(t, covers(exact, corner))
+
+	rules := map[string]MaskRule{
+		"color": ExcludeColor(color.White, 60),
+		"light": ExcludeLight(0.8),
+	}
+	for name, rule := range rules {
+		boxes, err := LoadMaskFunc(path, 90, 90, rule)
+		assert.NoError(t, err, name)
+		assert.True(t, covers(boxes, corner), name)
+		assert.False(t, covers(boxes, center), name)
+
+		inverted, err := MaskFromImageFunc(img, 90, 90, rule.Invert())
+		assert.NoError(t, err, name)
+		assert.False(t, covers(inverted, corner), name)
+		assert.True(t, covers(inverted, center), name)
+	}
+
+	shape := image.NewNRGBA(image.Rect(10, 10, 40, 40))
+	// One opaque cell
+	draw.Draw(shape, image.Rect(13, 13, 16, 16), image.Opaque, image.Point{}, draw.Src)
+	boxes, err := MaskFromImageFunc(shape, 30, 30, ExcludeAlphaBelow(128))
+	assert.NoError(t, err)
+	// Masked cells are merged into a few boxes covering everything but the opaque cell
+	assert.Len(t, boxes, 4)
+	area := 0.0
+	for _, b := range boxes {
+		area += b.w() * b.h()
+	}
+	assert.Equal(t, 30.0*30-3*3, area)
+
+	// A 1px black stroke on white is masked by MaskFromImage as it always was, not by the majority vote
+	stroke := image.NewRGBA(image.Rect(0, 0, 30, 30))
+	draw.Draw(stroke, stroke.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(stroke, image.Rect(0, 0, 1, 30), image.Black, image.Point{}, draw.Src)
+	black := color.RGBA{A: 255}
+	boxes, err = MaskFromImage(stroke, 30, 30, black)
+	assert.NoError(t, err)
+	if assert.Len(t, boxes, 1) {
+		assert.Equal(t, Box{Top: 30, Left: 0, Right: 3, Bottom: 0}, *boxes[0])
+	}
+	boxes, err = MaskFromImageFunc(stroke, 30, 30, ExcludeColor(black, 0))
+	assert.NoError(t, err)
+	assert.Empty(t, boxes)
+}
+
+func TestShapeMask(t *testing.T) {
+	masks := func(boxes []*Box, x float64, y float64) bool {
+		p := &Box{Top: y + 1, Left: x - 1, Right: x + 1, Bottom: y - 1}
+		for _, m := range boxes {
+			if m.overlaps(p) {
+				return true
+			}
+		}
+		return false
+	}
+	text, err := TextShape("O", DefaultFont)
+	assert.NoError(t, err)
+	_, err = TextShape("O", FontPath("testdata/missing.ttf"))
+	var fontErr *FontError
+	if assert.True(t, errors.As(err, &fontErr)) {
+		assert.True(t, errors.Is(fontErr.Err, os.ErrNotExist))
+		_, nested := fontErr.Err.(*FontError)
+		assert.False(t, nested)
+	}
+	// A square with a square hole, the hole is drawn the other way round
+	frame, err := SVGPathShape("M0 0 H10 V10 H0 Z m3 3 v4 h4 v-4 z")
+	assert.NoError(t, err)
+	curved, err := SVGPathShape("M 0,5 C 0,-1.5 10,-1.5 10,5 S 0,11.5 0,5 z")
+	assert.NoError(t, err)
+
+	star, err := StarShape(5, 0.4)
+	assert.NoError(t, err)
+	triangle, err := PolygonShape(3)
+	assert.NoError(t, err)
+
+	shapes := map[string]struct {
+		shape  Shape
+		inside [][2]float64
+		masked [][2]float64
+	}{
+		"circle":  {CircleShape(), [][2]float64{{100, 100}, {100, 5}}, [][2]float64{{5, 5}, {195, 195}}},
+		"ellipse": {EllipseShape(), [][2]float64{{100, 100}, {5, 100}}, [][2]float64{{5, 5}}},
+		"rect":    {RoundedRectShape(50), [][2]float64{{100, 100}, {5, 100}}, [][2]float64{{2, 2}}},
+		"heart":   {HeartShape(), [][2]float64{{100, 100}, {50, 50}}, [][2]float64{{100, 30}, {5, 195}}},
+		"star":    {star, [][2]float64{{100, 100}, {100, 40}}, [][2]float64{{100, 190}, {5, 5}}},
+		"polygon": {triangle, [][2]float64{{100, 100}}, [][2]float64{{5, 5}, {195, 5}}},
+		"text":    {text, [][2]float64{{100, 10}}, [][2]float64{{100, 100}, {5, 5}}},
+		"frame":   {frame, [][2]float64{{30, 30}}, [][2]float64{{100, 100}}},
+		"curved":  {curved, [][2]float64{{100, 100}}, [][2]float64{{3, 3}}},
+	}
+	for name, s := range shapes {
+		boxes, err := ShapeMask(s.shape, 200, 200)
+		assert.NoError(t, err, name)
+		for _, p := range s.inside {
+			assert.False(t, masks(boxes, p[0], p[1]), "%s %v", name, p)
+		}
+		for _, p := range s.masked {
+			assert.True(t, masks(boxes, p[0], p[1]), "%s %v", name, p)
+		}
+	}
+
+	invalid := []func() (Shape, error){
+		func() (Shape, error) { return PolygonShape(-3) },
+		func() (Shape, error) { return PolygonShape(2) },
+		func() (Shape, error) { return StarShape(1, 0.4) },
+		func() (Shape, error) { return StarShape(5, 0) },
+		func() (Shape, error) { return StarShape(5, 1) },
+		func() (Shape, error) { return StarShape(5, math.NaN()) },
+	}
+	for i, f := range invalid {
+		_, err := f()
+		var maskErr *MaskError
+		assert.True(t, errors.As(err, &maskErr), i)
+	}
+
+	for _, d := range []string{"", "M0 0 A 5 5 0 0 1 10 10", "M0 0 L 1", "M0 0 L1 1 L2 x", "10 10", "M0 0 L1 0 L1 1 Z 4"} {
+		_, err := SVGPathShape(d)
+		var maskErr *MaskError
+		assert.True(t, errors.As(err, &maskErr), d)
+	}
+}
+
+func BenchmarkMask(b *testing.B) {
+	inputWords := loadTestWords(b)
+	transparent := color.RGBA{}
+	newWordcloud := func(boxes []*Box) *Wordcloud {
+		return NewWordcloud(inputWords,
+			FontFile("testdata/Roboto-Regular.ttf"),
+			FontMaxSize(300),
+			FontMinSize(30),
+			MaskBoxes(boxes),
+			Height(2048),
+			Width(2048),
+			Seed(1),
+		)
+	}
+	b.Run("Init", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			newWordcloud(Mask("testdata/mask.png", 2048, 2048, transparent))
+		}
+	})
+	b.Run("Draw", func(b *testing.B) {
+		boxes := Mask("testdata/mask.png", 2048, 2048, transparent)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			newWordcloud(boxes).Draw()
+		}
+	})
+}
+
+func TestWordcloud_ColorsFromImage(t *testing.T) {
+	// Red on the left, blue on the right, scaled up to the canvas
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	draw.Draw(img, image.Rect(0, 0, 20, 20), image.NewUniform(color.NRGBA{R: 0xff, A: 0xff}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(20, 0, 40, 20), image.NewUniform(color.NRGBA{B: 0xff, A: 0xff}), image.Point{}, draw.Src)
+
+	l := NewWordcloud(loadTestWords(t),
+		FontFile("testdata/Roboto-Regular.ttf"),
+		FontMaxSize(60),
+		ColorsFromImage(img),
+		Width(400),
+		Height(200),
+	).Layout()
+	sides := 0
+	for _, pw := range l.Words {
+		switch {
+		case pw.X+pw.Width/2 < 200:
+			assert.Equal(t, "#ff0000", pw.Color, pw.Word)
+			sides |= 1
+		case pw.X-pw.Width/2 > 200:
+			assert.Equal(t, "#0000ff", pw.Color, pw.Word)
+			sides |= 2
+		}
+	}
+	assert.Equal(t, 3, sides)
+
+	// Transparent images fall back to Colors
+	l = NewWordcloud(map[string]int{"transparent": 1},
+		FontFile("testdata/Roboto-Regular.ttf"),
+		FontMaxSize(40),
+		ColorsFromImage(image.NewNRGBA(image.Rect(0, 0, 10, 10))),
+		Colors([]color.Color{color.RGBA{G: 0xff, A: 0xff}}),
+		Width(400),
+		Height(200),
+	).Layout()
+	assert.Equal(t, "#00ff00", l.Words[0].Color)
+}
+
+func TestColormap(t *testing.T) {
+	assert.Equal(t, "#440154", hexColor(Viridis.At(0)))
+	assert.Equal(t, "#fde725", hexColor(Viridis.At(1)))
+	assert.Equal(t, "#fde725", hexColor(Viridis.At(2)))
+	gradient := Colormap{color.Black, color.White}
+	assert.Equal(t, "#808080", hexColor(gradient.At(0.5)))
+}
+
+func TestWordcloud_ColorSchemes(t *testing.T) {
+	words := map[string]int{"happy": 40, "sad": 30, "table": 20, "chair": 10}
+	red, green, blue := color.RGBA{R: 0xff, A: 0xff}, color.RGBA{G: 0xff, A: 0xff}, color.RGBA{B: 0xff, A: 0xff}
+	layout := func(opt Option) map[string]string {
+		l := NewWordcloud(words,
+			FontFile("testdata/Roboto-Regular.ttf"),
+			FontMaxSize(40),
+			Colors([]color.Color{blue}),
+			opt,
+			Width(400),
+			Height(400),
+		).Layout()
+		colors := make(map[string]string)
+		for _, pw := range l.Words {
+			colors[pw.Word] = pw.Color
+		}
+		assert.Len(t, colors, len(words))
+		return colors
+	}
+
+	colors := layout(ColorsByCount(Colormap{red, green}))
+	assert.Equal(t, "#00ff00", colors["happy"])
+	assert.Equal(t, hexColor(Colormap{red, green}.At(1.0/3)), colors["table"])
+	// The least frequent word gets the first color
+	assert.Equal(t, "#ff0000", colors["chair"])
+
+	// Words with the same count all get the last color
+	same := NewWordcloud(map[string]int{"happy": 10, "chair": 10},
+		FontFile("testdata/Roboto-Regular.ttf"),
+		ColorsByCount(Colormap{red, green}),
+		Width(400),
+		Height(400),
+	).Layout()
+	for _, pw := range same.Words {
+		assert.Equal(t, "#00ff00", pw.Color)
+	}
+
+	colors = layout(RankBuckets(2, []color.Color{red, green}))
+	assert.Equal(t, map[string]string{"happy": "#ff0000", "sad": "#ff0000", "table": "#00ff00", "chair": "#00ff00"}, colors)
+
+	colors = layout(WordColors(map[string]color.Color{"table": red}))
+	assert.Equal(t, map[string]string{"happy": "#0000ff", "sad": "#0000ff", "table": "#ff0000", "chair": "#0000ff"}, colors)
+
+	colors = layout(CategoryColors(
+		map[string]string{"happy": "positive", "sad": "negative"},
+		map[string]color.Color{"positive": green, "negative": red},
+	))
+	assert.Equal(t, map[string]string{"happy": "#00ff00", "sad": "#ff0000", "table": "#0000ff", "chair": "#0000ff"}, colors)
+}
+
+func TestWordcloud_Weighted(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	rotation := 90.0
+	words := []Word{
+		{Text: "second", Weight: 0.5},
+		{Text: "first", Weight: 0.5},
+		{Text: "top", Weight: 2.25, URL: "https://example.com/?a=1&b=2", Meta: map[string]interface{}{"id": 7}},
+		{Text: "red", Weight: 0.25, Color: red, Rotation: &rotation},
+		{Text: "fixed", Weight: 0.1, Size: 30, Position: &image.Point{X: 50, Y: 50}},
+	}
+	w, err := NewWeighted(words,
+		FontFile("testdata/Roboto-Regular.ttf"),
+		FontMaxSize(80),
+		FontMinSize(10),
+		Colors([]color.Color{color.Black}),
+		Width(400),
+		Height(400),
+	)
+	assert.NoError(t, err)
+	l := w.Layout()
+	assert.Len(t, l.Words, len(words))
+
+	// Pinned words come first, ties keep the order of the list
+	order := make([]string, 0, len(l.Words))
+	placed := make(map[string]PlacedWord)
+	for _, pw := range l.Words {
+		order = append(order, pw.Word)
+		placed[pw.Word] = pw
+	}
+	assert.Equal(t, []string{"fixed", "top", "second", "first", "red"}, order)
+
+	assert.Equal(t, 2.25, placed["top"].Weight)
+	assert.Equal(t, 2, placed["top"].Count)
+	assert.Equal(t, 80.0, placed["top"].FontSize)
+	assert.Equal(t, "https://example.com/?a=1&b=2", placed["top"].URL)
+	assert.Equal(t, 7, placed["top"].Meta["id"])
+	assert.Equal(t, "#ff0000", placed["red"].Color)
+	assert.Equal(t, 90.0, placed["red"].Rotation)
+	assert.Equal(t, 30.0, placed["fixed"].FontSize)
+	assert.Equal(t, 50.0, placed["fixed"].X)
+	assert.Equal(t, 50.0, placed["fixed"].Y)
+
+	var svg strings.Builder
+	assert.NoError(t, w.DrawSVG(&svg))
+	assert.Contains(t, svg.String(), `<a href="https://example.com/?a=1&amp;b=2"><text`)
+
+	_, err = NewWeighted([]Word{{Text: "nan", Weight: math.NaN()}})
+	var wordErr *WordError
+	assert.True(t, errors.As(err, &wordErr))
+	_, err = NewWeighted(nil)
+	assert.True(t, errors.Is(err, ErrNoWords))
+}
+
+func TestWordcloud_Pinned(t *testing.T) {
+	words := make([]Word, 0)
+	for word, count := range loadTestWords(t) {
+		words = append(words, Word{Text: word, Weight: float64(count)})
+	}
+	sort.Slice(words, func(i, j int) bool { return words[i].Text < words[j].Text })
+	pins := map[string]image.Point{"ACME": {X: 256, Y: 256}, "NorthWest": {X: 110, Y: 30}, "SouthEast": {X: 400, Y: 480}}
+	for word, pos := range pins {
+		pos := pos
+		words = append(words, Word{Text: word, Weight: 0, Size: 40, Position: &pos})
+	}
+	l, err := NewWeighted(words,
+		FontFile("testdata/Roboto-Regular.ttf"),
+		FontMaxSize(100),
+		FontMinSize(10),
+		Width(512),
+		Height(512),
+		Seed(1),
+	)
+	assert.NoError(t, err)
+	layout := l.Layout()
+
+	textBox := func(pw PlacedWord) *Box {
+		return &Box{Top: pw.Y + pw.Height/2, Left: pw.X - pw.Width/2, Right: pw.X + pw.Width/2, Bottom: pw.Y - pw.Height/2}
+	}
+	pinned := make([]*Box, 0)
+	for i, pw := range layout.Words {
+		if i < len(pins) {
+			assert.Equal(t, float64(pins[pw.Word].X), pw.X, pw.Word)
+			assert.Equal(t, float64(pins[pw.Word].Y), pw.Y, pw.Word)
+			assert.Equal(t, 40.0, pw.FontSize)
+			pinned = append(pinned, pw.Boxes...)
+			continue
+		}
+		_, ok := pins[pw.Word]
+		assert.False(t, ok, "%s placed after the other words", pw.Word)
+		// Other words flow around the pinned ones
+		for _, p := range pinned {
+			assert.False(t, textBox(pw).overlaps(p), "%s overlaps a pinned word", pw.Word)
+		}
+	}
+	assert.Greater(t, len(layout.Words), 3*len(pins))
+}
+
+func TestWordcloud_PinnedDoNotShrink(t *testing.T) {
+	// Overlapping pins never both fit, whatever the scale
+	one, two := image.Pt(200, 200), image.Pt(205, 200)
+	words := []Word{
+		{Text: "PINONE", Size: 40, Position: &one},
+		{Text: "PINTWO", Size: 40, Position: &two},
+		{Text: "happy", Weight: 40},
+		{Text: "table", Weight: 20},
+		{Text: "chair", Weight: 10},
+	}
+	for _, opt := range []Option{ShrinkToFit(), AutoFit(0.01)} {
+		w, err := NewWeighted(words,
+			FontFile("testdata/Roboto-Regular.ttf"),
+			FontMaxSize(40),
+			FontMinSize(6),
+			Width(400),
+			Height(400),
+			Seed(1),
+			opt,
+		)
+		assert.NoError(t, err)
+		layout := w.Layout()
+		assert.Equal(t, []string{"PINTWO"}, layout.Unplaced)
+		assert.Equal(t, 1, layout.Passes)
+		assert.Equal(t, 1.0, layout.Scale)
+		for _, pw := range layout.Words {
+			if pw.Word == "happy" {
+				assert.Equal(t, 40.0, pw.FontSize)
+			}
+		}
+	}
+}
+
+func TestSizeFunctions(t *testing.T) {
+	assert.Equal(t, 0.0, sizeLog(0))
+	assert.Equal(t, 1.0, sizeLog(1))
+	assert.InDelta(t, 0.28, sizeLog(0.1), 0.01)
+	assert.Equal(t, 0.25, sizePower(2)(0.5))
+	assert.Equal(t, 1.0, rankPosition(0, 1))
+	assert.Equal(t, 0.5, rankPosition(1, 3))
+
+	words := map[string]int{"top": 1000, "tail": 2, "long": 2, "end": 1}
+	sizes := func(opts ...Option) map[string]float64 {
+		opts = append([]Option{FontFile("testdata/Roboto-Regular.ttf"), FontMaxSize(60), FontMinSize(10),
+			Width(400), Height(400)}, opts...)
+		w, err := New(words, opts...)
+		assert.NoError(t, err)
+		res := make(map[string]float64)
+		for _, pw := range w.Layout().Words {
+			res[pw.Word] = math.Round(pw.FontSize*100) / 100
+		}
+		assert.Len(t, res, len(words))
+		return res
+	}
+
+	// Counts make the tail unreadable, ranks do not
+	assert.Equal(t, map[string]float64{"top": 60, "tail": 10, "long": 10, "end": 10}, sizes())
+	assert.Equal(t, map[string]float64{"top": 60, "tail": 40, "long": 40, "end": 10}, sizes(SizeByRank()))
+	assert.Equal(t, map[string]float64{"top": 60, "tail": 26.67, "long": 26.67, "end": 10}, sizes(SizeByRank(), WordSizePower(2)))
+
+	// Results are clamped
+	assert.Equal(t, map[string]float64{"top": 60, "tail": 60, "long": 60, "end": 60},
+		sizes(SizeFunction(func(x float64) float64 { return 2 })))
+
+	for _, opt := range []Option{SizeFunction(func(x float64) float64 { return math.NaN() }), SizeFunction(nil), WordSizePower(0)} {
+		_, err := New(words, opt)
+		var optErr *OptionError
+		if assert.True(t, errors.As(err, &optErr)) {
+			assert.Equal(t, "SizeFunction", optErr.Option)
+		}
+	}
+}
+
+func TestWordcloud_TransparentBackground(t *testing.T) {
+	translucent := color.NRGBA{R: 0x20, G: 0x40, B: 0x80, A: 0x80}
+	w := NewWordcloud(map[string]int{"overlay": 10, "slide": 5},
+		FontFile("testdata/Roboto-Regular.ttf"),
+		FontMaxSize(100),
+		TransparentBackground(),
+		Colors([]color.Color{translucent}),
+		Width(400),
+		Height(400),
+	)
+	img := w.Draw()
+	_, _, _, a := img.At(0, 0).RGBA()
+	assert.Equal(t, uint32(0), a)
+
+	l := w.Layout()
+	assert.Len(t, l.Words, 2)
+	p := l.Words[0]
+	inked := false
+	for x := int(p.X - p.Width/2); x < int(p.X+p.Width/2) && !inked; x++ {
+		_, _, _, a = img.At(x, int(p.Y)).RGBA()
+		inked = a != 0
+	}
+	assert.True(t, inked)
+	// Ink is detected whatever the colors, large words get boxes around their letters
+	assert.Greater(t, len(p.Boxes), 1)
+
+	var svg strings.Builder
+	assert.NoError(t, w.DrawSVG(&svg))
+	assert.NotContains(t, svg.String(), "<rect")
+
+	// Words with the background color are still detected
+	w = NewWordcloud(map[string]int{"white": 10},
+		FontFile("testdata/Roboto-Regular.ttf"),
+		FontMaxSize(100),
+		Colors([]color.Color{color.White}),
+		BackgroundColor(color.White),
+		Width(400),
+		Height(400),
+	)
+	assert.Greater(t, len(w.Layout().Words[0].Boxes), 1)
+}
@@ -0,0 +1,135 @@
+package wordclouds
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Word is an entry of a weighted word list, such as a TF-IDF score or a keyword extraction weight.
+// All fields but Text and Weight are optional overrides of the wordcloud options for this word.
+type Word struct {
+	Text   string
+	Weight float64
+
+	// Color of the word, instead of the color scheme
+	Color color.Color
+	// Font of the word, instead of the font policy. Characters missing from it fall back to the fonts set with
+	// Fonts or FontFiles. Words sharing the same *FontSource parse it once.
+	Font *FontSource
+	// Rotation in degrees clockwise, instead of the rotation policy
+	Rotation *float64
+	// Font size in pixels instead of the size computed from the weight. Fixed sizes are not scaled by ShrinkToFit
+	// or AutoFit.
+	Size float64
+	// Position of the word anchor, at the center of its text box. Pinned words are placed before the others, which
+	// flow around them. The word is not placed if it does not fit there.
+	Position *image.Point
+	// Link reported by Layout and added to the SVG output
+	URL string
+	// Arbitrary data reported by Layout
+	Meta map[string]interface{}
+}
+
+// NewWeighted initializes a wordcloud from a weighted word list. Words with a Position are placed first, then the
+// others by decreasing weight. Words with the same weight keep their order in the list.
+// The returned error is an *OptionError, a *FontError, a *WordError or ErrNoWords.
+func NewWeighted(words []Word, options ...Option) (*Wordcloud, error) {
+	opts := defaultOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, ErrNoWords
+	}
+
+	sortedWordList := make([]wordCount, 0, len(words))
+	maxWeight, minWeight := 0.0, math.Inf(1)
+	// Word fonts are loaded after WordFonts
+	wordFonts := make(map[*FontSource]int)
+	for i := range words {
+		// Copy the entry so that later changes to words do not affect the wordcloud
+		entry := words[i]
+		if err := entry.validate(); err != nil {
+			return nil, err
+		}
+		maxWeight = math.Max(maxWeight, entry.Weight)
+		minWeight = math.Min(minWeight, entry.Weight)
+		font := -1
+		if entry.Font != nil {
+			idx, ok := wordFonts[entry.Font]
+			if !ok {
+				idx = len(opts.WordFonts)
+				opts.WordFonts = append(opts.WordFonts[:len(opts.WordFonts):len(opts.WordFonts)], *entry.Font)
+				wordFonts[entry.Font] = idx
+			}
+			font = idx
+		}
+		sortedWordList = append(sortedWordList, wordCount{
+			word:  strings.Trim(entry.Text, " "),
+			count: int(math.Round(entry.Weight)),
+			size:  5,
+			font:  font,
+			entry: &entry,
+		})
+	}
+	sort.SliceStable(sortedWordList, func(i, j int) bool {
+		return sortedWordList[i].entry.Weight > sortedWordList[j].entry.Weight
+	})
+
+	tieRank := 0
+	for idx := range sortedWordList {
+		word := &sortedWordList[idx]
+		word.rank = idx
+		word.weight = 1
+		if maxWeight > 0 {
+			word.weight = word.entry.Weight / maxWeight
+		}
+		// All the words are the most frequent when they have the same weight
+		word.spread = 1
+		if maxWeight > minWeight {
+			word.spread = (word.entry.Weight - minWeight) / (maxWeight - minWeight)
+		}
+		if idx > 0 && word.entry.Weight < sortedWordList[idx-1].entry.Weight {
+			tieRank = idx
+		}
+		if word.entry.Size > 0 {
+			word.size = word.entry.Size
+			continue
+		}
+		x := word.weight
+		if opts.SizeByRank {
+			x = rankPosition(tieRank, len(sortedWordList))
+		}
+		scale, err := opts.SizeFunction.scale(x)
+		if err != nil {
+			return nil, err
+		}
+		word.size = scale * float64(opts.FontMaxSize)
+		if word.size < float64(opts.FontMinSize) {
+			word.size = float64(opts.FontMinSize)
+		}
+	}
+
+	fonts, err := loadFonts(opts)
+	if err != nil {
+		return nil, err
+	}
+	return newWordcloud(sortedWordList, fonts, opts), nil
+}
+
+// validate reports invalid weights and sizes
+func (e *Word) validate() error {
+	if math.IsNaN(e.Weight) || math.IsInf(e.Weight, 0) || e.Weight < 0 {
+		return &WordError{Word: e.Text, Reason: "weight must be a positive number"}
+	}
+	if math.IsNaN(e.Size) || math.IsInf(e.Size, 0) || e.Size < 0 {
+		return &WordError{Word: e.Text, Reason: "size must be a positive number"}
+	}
+	return nil
+}